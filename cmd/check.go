@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var checkFlags struct {
+	output string
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that the repo's encrypted files are safe to commit, for CI.",
+	Long: fmt.Sprintf(`Check that no decrypted or plain file is tracked by git, and that every encrypted file in the repo is fully encrypted, with no values tagged !secret or !generate, and valid ciphertexts. The problems found are printed as text, JSON, or a JUnit XML report, picked with --output.
+The exit code has a bit set for each class of problem found: %d if a decrypted or plain file is tracked, %d for !secret values, %d for !generate values, %d for invalid ciphertexts, and %d for files that can't be read.`,
+		actions.TrackedPlaintext.ExitCode, actions.UnencryptedSecret.ExitCode, actions.UnresolvedGenerate.ExitCode, actions.InvalidCiphertext.ExitCode, actions.InvalidFile.ExitCode),
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		code, err := Check(os.Stdout, checkFlags.output)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+		return nil
+	},
+}
+
+// Check the repo, print the results in the given format, and return the exit code.
+func Check(stdout io.Writer, output string) (int, error) {
+	config, err := config.LoadConfig(".")
+	if err != nil {
+		return 0, err
+	}
+	var write func(actions.CheckResult, io.Writer) error
+	switch output {
+	case "text":
+		write = actions.CheckResult.WriteText
+	case "json":
+		write = actions.CheckResult.WriteJSON
+	case "junit":
+		write = actions.CheckResult.WriteJUnit
+	default:
+		return 0, fmt.Errorf("Unknown output format %s, must be one of: text, json, junit", output)
+	}
+	result, err := actions.Check(&config)
+	if err != nil {
+		return 0, err
+	}
+	if err := write(result, stdout); err != nil {
+		return 0, err
+	}
+	return result.ExitCode(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().StringVarP(&checkFlags.output, "output", "o", "text", "format to print the results in: text, json, or junit")
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+)
+
+const badEncrypted = `a: !secret hunter2
+b: !generate
+c: !encrypted not base64!
+d: !encrypted ""
+e: !encrypted Aai/5cPW0+wX/r6JuNHWUbDPryxznFwHyY/xc1wcuwqsjePOhQDDaBOzwv1+
+`
+
+func TestCheck(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// files whose names only happen to end with the suffixes' text aren't managed by yaml-crypt
+		if err := ioutil.WriteFile("ex"+repo.Suffixes["plain"], []byte("a: b\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile("un"+repo.Suffixes["encrypted"], []byte("a: !secret b\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, "init", "-q")
+		runGit(t, "add", ".")
+		var out bytes.Buffer
+		code, err := Check(&out, "text")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != 0 || !strings.HasSuffix(out.String(), "found 0 problems\n") {
+			t.Errorf("Check of the fixtures in repo %s should pass, got %d:\n%s", repo, code, out.String())
+		}
+
+		// a tracked decrypted file, and an encrypted file with every kind of bad value
+		err = repo.Checkout("original")
+		if err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, "add", "-f", repo.Files[0].TmpPath("original"))
+		bad := "bad." + repo.Suffixes["encrypted"]
+		if err := ioutil.WriteFile(bad, []byte(badEncrypted), 0644); err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+		code, err = Check(&out, "json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != 2|4|8|16 {
+			t.Errorf("Check in repo %s should exit with %d, got %d", repo, 2|4|8|16, code)
+		}
+		var result struct {
+			Failures []struct {
+				Class string
+				File  string
+				Path  string
+			}
+			ExitCode int
+		}
+		if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		var found []string
+		for _, failure := range result.Failures {
+			found = append(found, failure.Class+" "+failure.File+" "+failure.Path)
+		}
+		sort.Strings(found)
+		expected := []string{
+			"invalid-ciphertext " + bad + ` 0."c"`,
+			"invalid-ciphertext " + bad + ` 0."d"`,
+			"tracked-plaintext " + repo.Files[0].Name + "." + repo.Suffixes["decrypted"] + " ",
+			"unencrypted-secret " + bad + ` 0."a"`,
+			"unresolved-generate " + bad + ` 0."b"`,
+		}
+		if strings.Join(found, "\n") != strings.Join(expected, "\n") || result.ExitCode != code {
+			t.Errorf("Check in repo %s found the wrong problems:\n%s", repo, out.String())
+		}
+
+		out.Reset()
+		if _, err := Check(&out, "junit"); err != nil {
+			t.Fatal(err)
+		}
+		var report struct {
+			Suites []struct {
+				Tests    int `xml:"tests,attr"`
+				Failures int `xml:"failures,attr"`
+			} `xml:"testsuite"`
+		}
+		if err := xml.Unmarshal(out.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Suites) != 1 || report.Suites[0].Failures != 2 || report.Suites[0].Tests != len(repo.Files)+2 {
+			t.Errorf("JUnit report in repo %s is incorrect:\n%s", repo, out.String())
+		}
+	}
+}
+
+const checkConfigSecrets = `kubernetesSecrets: true
+secretRules:
+  - paths: ["**.password"]
+`
+
+const unencryptedByRules = `db:
+  password: hunter2
+  user: admin
+  replica:
+    password: !encrypted Aai/5cPW0+wX/r6JuNHWUbDPryxznFwHyY/xc1wcuwqsjePOhQDDaBOzwv1+
+`
+
+const unencryptedKubernetesSecret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: test
+data:
+  token: aHVudGVyMg==
+  key: !encrypted Aai/5cPW0+wX/r6JuNHWUbDPryxznFwHyY/xc1wcuwqsjePOhQDDaBOzwv1+
+stringData:
+  key: hunter2
+`
+
+func TestCheckConfigSecrets(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := ioutil.ReadFile(".yamlcrypt.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(".yamlcrypt.yaml", append(config, []byte(checkConfigSecrets)...), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// values that encrypt would encrypt without tags still have to be encrypted
+		rules, secret := "rules."+repo.Suffixes["encrypted"], "secret."+repo.Suffixes["encrypted"]
+		if err := ioutil.WriteFile(rules, []byte(unencryptedByRules), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(secret, []byte(unencryptedKubernetesSecret), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, "init", "-q")
+		var out bytes.Buffer
+		code, err := Check(&out, "text")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != 4 {
+			t.Errorf("Check in repo %s should exit with 4, got %d", repo, code)
+		}
+		for _, expected := range []string{
+			rules + ` 0."db"."password": unencrypted-secret`,
+			secret + ` 0."data"."token": unencrypted-secret`,
+			secret + ` 0."stringData"."key": unencrypted-secret`,
+		} {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("Check in repo %s should find %s:\n%s", repo, expected, out.String())
+			}
+		}
+		if !strings.HasSuffix(out.String(), "found 3 problems\n") {
+			t.Errorf("Check in repo %s found the wrong problems:\n%s", repo, out.String())
+		}
+	}
+}
@@ -32,11 +32,8 @@ var DecryptCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		cache, err := cache.Setup(config, disableCache)
-		if err != nil {
-			return err
-		}
-		defer cache.Close()
+		caches := cache.SetupCaches(config, disableCache)
+		defer caches.Close()
 		if len(args) == 0 {
 			args = []string{config.Root}
 		}
@@ -56,17 +53,17 @@ var DecryptCmd = &cobra.Command{
 			for _, path := range paths {
 				var file actions.File
 				if DecryptFlags.Stdout || DecryptFlags.JSON {
-					file = actions.File{EncryptedPath: path}
+					file, err = actions.NewStdoutFile(path, &config)
 				} else {
 					file, err = actions.NewFile(path, &config)
-					if err != nil {
-						return err
-					}
+				}
+				if err != nil {
+					return err
 				}
 				files = append(files, &file)
 			}
 		}
-		return actions.Decrypt(files, DecryptFlags.Plain, DecryptFlags.Stdout, DecryptFlags.JSON, cache, &config.Provider, int(threads), retries, timeout, progress)
+		return actions.Decrypt(files, DecryptFlags.Plain, DecryptFlags.Stdout, DecryptFlags.JSON, caches, int(threads), retries, timeout, progress)
 	},
 }
 
@@ -12,6 +12,9 @@ func TestDecrypt(t *testing.T) {
 		t.Fatal(err)
 	}
 	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
 		DecryptFlags.Plain = false
 		err := repo.Setup()
 		//defer repo.Destroy()
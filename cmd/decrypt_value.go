@@ -15,6 +15,9 @@ import (
 
 var decryptValueFlags struct {
 	no_newline bool
+	file       string
+	document   uint
+	path       string
 }
 
 var decryptValueCmd = &cobra.Command{
@@ -24,11 +27,11 @@ var decryptValueCmd = &cobra.Command{
 	Args:                  cobra.NoArgs,
 	DisableFlagsInUseLine: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return DecryptValue(os.Stdin, os.Stdout, decryptValueFlags.no_newline)
+		return DecryptValue(os.Stdin, os.Stdout, decryptValueFlags.no_newline, decryptValueFlags.file, decryptValueFlags.document, decryptValueFlags.path)
 	},
 }
 
-func DecryptValue(stdin io.Reader, stdout io.Writer, no_newline bool) error {
+func DecryptValue(stdin io.Reader, stdout io.Writer, no_newline bool, file string, document uint, path string) error {
 	reader := bufio.NewReader(stdin)
 	encodedCiphertext, err := reader.ReadString('\n')
 	if err != nil {
@@ -45,12 +48,17 @@ func DecryptValue(stdin io.Reader, stdout io.Writer, no_newline bool) error {
 		if err != nil {
 			return err
 		}
-		cache, err := cache.Setup(config, disableCache)
+		f, aad, err := valueFile(&config, file, document, path)
 		if err != nil {
 			return err
 		}
-		defer cache.Close()
-		plaintext, err = actions.DecryptCiphertext(ciphertext, cache, &config.Provider, retries, timeout)
+		caches := cache.SetupCaches(config, disableCache)
+		defer caches.Close()
+		cache, err := caches.Get(f.ProviderName)
+		if err != nil {
+			return err
+		}
+		plaintext, err = actions.DecryptCiphertext(ciphertext, aad, cache, &f.Provider, retries, timeout)
 		return err
 	}()
 	if err != nil {
@@ -67,4 +75,7 @@ func DecryptValue(stdin io.Reader, stdout io.Writer, no_newline bool) error {
 func init() {
 	rootCmd.AddCommand(decryptValueCmd)
 	decryptValueCmd.Flags().BoolVarP(&decryptValueFlags.no_newline, "no-newline", "n", false, "do not print a trailing newline.")
+	decryptValueCmd.Flags().StringVarP(&decryptValueFlags.file, "file", "f", "", "file the value is stored in, when bindPaths is enabled or the config has provider rules")
+	decryptValueCmd.Flags().UintVarP(&decryptValueFlags.document, "document", "", 0, "index of the yaml document the value is stored in, for files with several documents")
+	decryptValueCmd.Flags().StringVarP(&decryptValueFlags.path, "path", "", "", "yaml path the value is stored at, when bindPaths is enabled, eg. db.password")
 }
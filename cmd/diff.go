@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var diffFlags struct {
+	showValues bool
+}
+
+var diffCmd = &cobra.Command{
+	Use:                   "diff [rev1] [rev2] [--] [path]...",
+	Short:                 "Show which secret values changed between revisions in git.",
+	Long:                  "Decrypt the encrypted files in two revisions in git, and list the paths of the secret values that were added (+), removed (-), or changed (~) between them. With no revisions, HEAD is compared to the working tree; with one, that revision is compared to the working tree. Only files under the given paths are compared, if there are any. Values are hidden unless --show-values is given.",
+	Args:                  cobra.ArbitraryArgs,
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return Diff(os.Stdout, args, cmd.ArgsLenAtDash(), diffFlags.showValues)
+	},
+}
+
+// Compare the secret values in revisions given by the leading args, up to the one before dash if it isn't -1, and files under the paths given by the rest.
+func Diff(stdout io.Writer, args []string, dash int, showValues bool) error {
+	config, err := config.LoadConfig(".")
+	if err != nil {
+		return err
+	}
+	var revs, paths []string
+	if dash != -1 {
+		revs, paths = args[:dash], args[dash:]
+	} else {
+		for len(revs) < 2 && len(revs) < len(args) && actions.IsRevision(&config, args[len(revs)]) {
+			revs = append(revs, args[len(revs)])
+		}
+		paths = args[len(revs):]
+	}
+	oldRev, newRev := "HEAD", ""
+	switch len(revs) {
+	case 0:
+	case 1:
+		oldRev = revs[0]
+	case 2:
+		oldRev, newRev = revs[0], revs[1]
+	default:
+		return errors.New("At most two revisions can be compared")
+	}
+	// paths are given relative to the working directory, but git is run in the root of the repo
+	for i, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if paths[i], err = filepath.Rel(config.Root, abs); err != nil {
+			return err
+		}
+	}
+	caches := cache.SetupCaches(config, disableCache)
+	defer caches.Close()
+	diffs, err := actions.DiffRevisions(&config, oldRev, newRev, paths, caches, int(threads), retries, timeout, progress)
+	if err != nil {
+		return err
+	}
+	newLabel := newRev
+	if newRev == "" {
+		newLabel = "working tree"
+	}
+	return actions.WriteDiff(stdout, diffs, oldRev, newLabel, showValues)
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().BoolVarP(&diffFlags.showValues, "show-values", "", false, "show the values that changed, not just their paths")
+}
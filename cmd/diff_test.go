@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+)
+
+func runGit(t *testing.T, args ...string) {
+	out, err := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Error running git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	progress = false
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range repo.Files {
+			if file.Name != "nested_values" {
+				continue
+			}
+			path := file.TmpPath(repo.Provider)
+			name := filepath.Base(path)
+			runGit(t, "init", "-q")
+			runGit(t, "add", name)
+			runGit(t, "commit", "-q", "-m", "initial")
+			value := "new secret"
+			if err := Set(strings.NewReader(value), path, "d.2.a.c.d.e", true, true, "", 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := Set(strings.NewReader(value), path, "new.key", true, true, "", 0); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := Diff(&out, []string{name}, -1, false); err != nil {
+				t.Fatal(err)
+			}
+			expected := "--- a/" + name + " (HEAD)\n+++ b/" + name + " (working tree)\n" + `~ "d".2."a"."c"."d"."e"` + "\n" + `+ "new"."key"` + "\n"
+			if out.String() != expected {
+				t.Errorf("Diff of the working tree in repo %s is incorrect:\n%s", repo, out.String())
+			}
+			runGit(t, "commit", "-q", "-a", "-m", "change")
+			out.Reset()
+			if err := Diff(&out, []string{"HEAD~1", "HEAD", name}, -1, true); err != nil {
+				t.Fatal(err)
+			}
+			expected = "--- a/" + name + " (HEAD~1)\n+++ b/" + name + " (HEAD)\n" + `~ "d".2."a"."c"."d"."e"` + "\n  - secret 2\n  + new secret\n" + `+ "new"."key"` + "\n  + new secret\n"
+			if out.String() != expected {
+				t.Errorf("Diff between revisions in repo %s is incorrect:\n%s", repo, out.String())
+			}
+			out.Reset()
+			if err := Diff(&out, []string{name}, -1, false); err != nil || out.String() != "" {
+				t.Errorf("Diff of an unchanged working tree in repo %s should be empty, got %q, %v", repo, out.String(), err)
+			}
+		}
+	}
+}
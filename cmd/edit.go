@@ -53,12 +53,9 @@ var editCmd = &cobra.Command{
 
 		// decrypt
 		err = func() error {
-			cache, err := cache.Setup(config, disableCache)
-			if err != nil {
-				return err
-			}
-			defer cache.Close()
-			return actions.Decrypt([]*actions.File{&file}, false, false, false, cache, &config.Provider, int(threads), retries, timeout, progress)
+			caches := cache.SetupCaches(config, disableCache)
+			defer caches.Close()
+			return actions.Decrypt([]*actions.File{&file}, false, false, false, caches, int(threads), retries, timeout, progress)
 		}()
 		if err != nil {
 			return err
@@ -76,14 +73,11 @@ var editCmd = &cobra.Command{
 		}
 
 		// re-open cache
-		cache, err := cache.Setup(config, disableCache)
-		if err != nil {
-			return err
-		}
-		defer cache.Close()
+		caches := cache.SetupCaches(config, disableCache)
+		defer caches.Close()
 
 		// encrypt
-		err = actions.Encrypt([]*actions.File{&file}, cache, &config.Provider, int(threads), retries, timeout, progress, disableCache)
+		err = actions.Encrypt([]*actions.File{&file}, caches, int(threads), retries, timeout, progress, disableCache, false)
 		if err != nil {
 			return err
 		}
@@ -101,7 +95,7 @@ var editCmd = &cobra.Command{
 			return err
 		}
 		// update plain file
-		return actions.Decrypt([]*actions.File{&file}, true, false, false, cache, &config.Provider, int(threads), retries, timeout, progress)
+		return actions.Decrypt([]*actions.File{&file}, true, false, false, caches, int(threads), retries, timeout, progress)
 	},
 }
 
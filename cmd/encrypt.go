@@ -9,10 +9,14 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var encryptFlags struct {
+	force bool
+}
+
 var EncryptCmd = &cobra.Command{
 	Use:                   "encrypt [file|directory]...",
 	Short:                 "Encrypt one or more decrypted files in the repo, replacing the contents of the encrypted files.",
-	Long:                  "Encrypt one or more decrypted files in the repo, replacing the contents of the corresponding encrypted files. Each arg can refer to either a file, in which case the file will be encrypted, or a directory, in which case all files under the directory will be encrypted. File args can refer to encrypted, decrypted, or plain files, existant or non-existant, as long as the correponding decrypted file exists. Supplying no args will encrypt all decrypted files in the repo.",
+	Long:                  "Encrypt one or more decrypted files in the repo, replacing the contents of the corresponding encrypted files. Each arg can refer to either a file, in which case the file will be encrypted, or a directory, in which case all files under the directory will be encrypted. File args can refer to encrypted, decrypted, or plain files, existant or non-existant, as long as the correponding decrypted file exists. Supplying no args will encrypt all decrypted files in the repo. Files whose encrypted versions have changed since they were decrypted are refused, so that their changes aren't overwritten, unless --force is given.",
 	Args:                  cobra.ArbitraryArgs,
 	DisableFlagsInUseLine: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -20,11 +24,8 @@ var EncryptCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		cache, err := cache.Setup(config, disableCache)
-		if err != nil {
-			return err
-		}
-		defer cache.Close()
+		caches := cache.SetupCaches(config, disableCache)
+		defer caches.Close()
 		if len(args) == 0 {
 			args = []string{config.Root}
 		}
@@ -49,10 +50,11 @@ var EncryptCmd = &cobra.Command{
 				files = append(files, &file)
 			}
 		}
-		return actions.Encrypt(files, cache, &config.Provider, int(threads), retries, timeout, progress, disableCache)
+		return actions.Encrypt(files, caches, int(threads), retries, timeout, progress, disableCache, encryptFlags.force)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(EncryptCmd)
+	EncryptCmd.Flags().BoolVarP(&encryptFlags.force, "force", "f", false, "encrypt even if the encrypted files have changed since they were decrypted, overwriting those changes.")
 }
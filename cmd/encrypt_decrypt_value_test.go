@@ -15,6 +15,9 @@ func TestEncryptDecryptValue(t *testing.T) {
 		t.Fatal(err)
 	}
 	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
 		err := repo.Setup()
 		defer repo.Destroy()
 		if err != nil {
@@ -62,13 +65,13 @@ func TestEncryptDecryptValue(t *testing.T) {
 func encryptValueTest(plaintext string, multiline bool) (string, error) {
 	plaintextReader := strings.NewReader(plaintext)
 	ciphertext := bytes.Buffer{}
-	err := EncryptValue(plaintextReader, &ciphertext, multiline)
+	err := EncryptValue(plaintextReader, &ciphertext, multiline, "", 0, "")
 	return ciphertext.String(), err
 }
 
 func decryptValueTest(ciphertext string) (string, error) {
 	ciphertextReader := strings.NewReader(ciphertext)
 	plaintext := bytes.Buffer{}
-	err := DecryptValue(ciphertextReader, &plaintext, false)
+	err := DecryptValue(ciphertextReader, &plaintext, false, "", 0, "")
 	return plaintext.String(), err
 }
@@ -15,6 +15,9 @@ func TestEncrypt(t *testing.T) {
 		t.Fatal(err)
 	}
 	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
 		DecryptFlags.Plain = false
 		err := repo.Setup()
 		defer repo.Destroy()
@@ -3,19 +3,25 @@ package cmd
 import (
 	"bufio"
 	"encoding/base64"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
 	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
 	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
 	"github.com/spf13/cobra"
 )
 
 var encryptValueFlags struct {
 	multiline bool
+	file      string
+	document  uint
+	path      string
 }
 
 var encryptValueCmd = &cobra.Command{
@@ -25,11 +31,43 @@ var encryptValueCmd = &cobra.Command{
 	Args:                  cobra.NoArgs,
 	DisableFlagsInUseLine: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return EncryptValue(os.Stdin, os.Stdout, encryptValueFlags.multiline)
+		return EncryptValue(os.Stdin, os.Stdout, encryptValueFlags.multiline, encryptValueFlags.file, encryptValueFlags.document, encryptValueFlags.path)
 	},
 }
 
-func EncryptValue(stdin io.Reader, stdout io.Writer, multiline bool) error {
+// Get the File a value will be stored in, which determines its provider, and the additional authenticated data a value at the given document and yaml path in it is bound to, if bindPaths is enabled.
+func valueFile(config *config.Config, file string, document uint, path string) (actions.File, []byte, error) {
+	if !config.BindPaths {
+		if path != "" || (file != "" && len(config.ProviderRules) == 0) {
+			return actions.File{}, nil, errors.New("--file and --path can only be used when bindPaths is enabled, or --file when the config has provider rules")
+		}
+		if file == "" {
+			return actions.File{Provider: config.Provider}, nil, nil
+		}
+		f, err := actions.NewStdoutFile(file, config)
+		return f, nil, err
+	}
+	if file == "" || path == "" {
+		return actions.File{}, nil, errors.New("--file and --path are required when bindPaths is enabled")
+	}
+	f, err := actions.NewStdoutFile(file, config)
+	if err != nil {
+		return f, nil, err
+	}
+	parsedPath, err := yaml.ParsePath(path)
+	if err != nil {
+		return f, nil, err
+	}
+	// paths within files start with the index of the yaml document
+	documentPath := strconv.FormatUint(uint64(document), 10)
+	if s := parsedPath.String(); s != "" {
+		documentPath += "." + s
+	}
+	// values from encrypt-value are strings, tagged !encrypted
+	return f, f.AAD(documentPath, yaml.EncryptedTag), nil
+}
+
+func EncryptValue(stdin io.Reader, stdout io.Writer, multiline bool, file string, document uint, path string) error {
 	var plaintext string
 	var err error
 	if multiline {
@@ -52,12 +90,17 @@ func EncryptValue(stdin io.Reader, stdout io.Writer, multiline bool) error {
 		if err != nil {
 			return err
 		}
-		cache, err := cache.Setup(config, disableCache)
+		f, aad, err := valueFile(&config, file, document, path)
+		if err != nil {
+			return err
+		}
+		caches := cache.SetupCaches(config, disableCache)
+		defer caches.Close()
+		cache, err := caches.Get(f.ProviderName)
 		if err != nil {
 			return err
 		}
-		defer cache.Close()
-		ciphertext, err = actions.EncryptPlaintext(string(plaintext), cache, &config.Provider, retries, timeout)
+		ciphertext, err = actions.EncryptPlaintext(string(plaintext), aad, cache, &f.Provider, retries, timeout)
 		return err
 	}()
 	if err != nil {
@@ -70,4 +113,7 @@ func EncryptValue(stdin io.Reader, stdout io.Writer, multiline bool) error {
 func init() {
 	rootCmd.AddCommand(encryptValueCmd)
 	encryptValueCmd.Flags().BoolVarP(&encryptValueFlags.multiline, "multi-line", "m", false, "Read multiple lines of input, stopping only at EOF.")
+	encryptValueCmd.Flags().StringVarP(&encryptValueFlags.file, "file", "f", "", "file the value will be stored in, when bindPaths is enabled or the config has provider rules")
+	encryptValueCmd.Flags().UintVarP(&encryptValueFlags.document, "document", "", 0, "index of the yaml document the value will be stored in, for files with several documents")
+	encryptValueCmd.Flags().StringVarP(&encryptValueFlags.path, "path", "", "", "yaml path the value will be stored at, when bindPaths is enabled, eg. db.password")
 }
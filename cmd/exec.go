@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/spf13/cobra"
+)
+
+var execFlags struct {
+	paths  []string
+	naming string
+	prefix string
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec <file> -- <command> [args]...",
+	Short: "Run a command with the secret values in a file as environment variables.",
+	Long:  "Decrypt a file in memory, and run a command with each of its !secret values in an environment variable, named after the value's path using the --naming scheme, like DB_PASSWORD for db.password. Only values matching the --paths patterns are included, if any are given. Plaintexts are never written to disk. Exits with the command's exit code.",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if cmd.ArgsLenAtDash() != 1 || len(args) < 2 {
+			return errors.New("requires a file, then -- and a command")
+		}
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		code, err := Exec(os.Stdin, os.Stdout, os.Stderr, args[0], args[1:], execFlags.paths, execFlags.naming, execFlags.prefix)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+		return nil
+	},
+}
+
+// Run a command with the secret values in a file as environment variables, and return its exit code.
+func Exec(stdin io.Reader, stdout io.Writer, stderr io.Writer, path string, command []string, patterns []string, naming string, prefix string) (int, error) {
+	name, ok := actions.EnvNamingSchemes[naming]
+	if !ok {
+		schemes := make([]string, 0, len(actions.EnvNamingSchemes))
+		for scheme := range actions.EnvNamingSchemes {
+			schemes = append(schemes, scheme)
+		}
+		sort.Strings(schemes)
+		return 0, fmt.Errorf("Unknown naming scheme %s, must be one of: %s", naming, strings.Join(schemes, ", "))
+	}
+	values, err := secretValues(path, patterns, func(segments []string) string { return prefix + name(segments) })
+	if err != nil {
+		return 0, err
+	}
+	child := exec.Command(command[0], command[1:]...)
+	child.Stdin = stdin
+	child.Stdout = stdout
+	child.Stderr = stderr
+	child.Env = os.Environ()
+	for _, value := range values {
+		child.Env = append(child.Env, value.Name+"="+value.Value)
+	}
+	err = child.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	execCmd.Flags().StringArrayVarP(&execFlags.paths, "paths", "", nil, "only include values whose paths match this pattern, like db.* or **.password; can be given more than once")
+	execCmd.Flags().StringVarP(&execFlags.naming, "naming", "", "upper-snake", "how to name environment variables after values' paths: upper-snake (DB_PASSWORD), snake (db_password), or key (password)")
+	execCmd.Flags().StringVarP(&execFlags.prefix, "prefix", "", "", "prefix for the names of the environment variables, like APP_")
+}
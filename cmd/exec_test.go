@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+)
+
+func TestExec(t *testing.T) {
+	progress = false
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range repo.Files {
+			if file.Name != "nested_values" {
+				continue
+			}
+			var out bytes.Buffer
+			code, err := Exec(strings.NewReader(""), &out, &out, file.TmpPath(repo.Provider), []string{"sh", "-c", `printf '%s|%s' "$APP_C" "$APP_D_2_A_C_D_E"; exit 3`}, []string{"c", "d.**"}, "upper-snake", "APP_")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != 3 {
+				t.Errorf("Exec from repo %s should exit with the command's exit code 3, got %d", repo, code)
+			}
+			if out.String() != "secret 1|secret 2" {
+				t.Errorf("Environment from repo %s is incorrect: %s", repo, out.String())
+			}
+			_, err = Exec(strings.NewReader(""), &out, &out, file.TmpPath(repo.Provider), []string{"true"}, nil, "camel", "")
+			if err == nil {
+				t.Errorf("Exec with an unknown naming scheme should fail")
+			}
+		}
+	}
+}
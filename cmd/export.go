@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var exportFlags struct {
+	name      string
+	namespace string
+	paths     []string
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print the secret values in an encrypted file in another format, without writing them to disk.",
+}
+
+var exportSecretCmd = &cobra.Command{
+	Use:                   "k8s-secret <file> --name <name> [--namespace <namespace>] [--paths <pattern>]...",
+	Short:                 "Print the secret values in a file as a Kubernetes Secret manifest.",
+	Long:                  "Decrypt a file in memory, and print a Kubernetes Secret manifest with each of its !secret values as a key in its data, named by joining the keys in the value's path with dots, like db.password. Only values matching the --paths patterns are included, if any are given.",
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return Export(os.Stdout, "Secret", args[0], exportFlags.name, exportFlags.namespace, exportFlags.paths)
+	},
+}
+
+var exportConfigMapCmd = &cobra.Command{
+	Use:                   "k8s-configmap <file> --name <name> [--namespace <namespace>] [--paths <pattern>]...",
+	Short:                 "Print the secret values in a file as a Kubernetes ConfigMap manifest.",
+	Long:                  "Decrypt a file in memory, and print a Kubernetes ConfigMap manifest with each of its !secret values as a key in its data, named by joining the keys in the value's path with dots, like db.password. Only values matching the --paths patterns are included, if any are given.",
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return Export(os.Stdout, "ConfigMap", args[0], exportFlags.name, exportFlags.namespace, exportFlags.paths)
+	},
+}
+
+// Decrypt a file in memory, and get its !secret values, or only those whose paths match any of the patterns, named by the given function.
+func secretValues(path string, patterns []string, name func([]string) string) ([]actions.ExportedValue, error) {
+	config, err := config.LoadConfig(".")
+	if err != nil {
+		return nil, err
+	}
+	parsedPatterns := make([]*yaml.PathPattern, len(patterns))
+	for i, pattern := range patterns {
+		if parsedPatterns[i], err = yaml.ParsePathPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	file, err := actions.NewStdoutFile(path, &config)
+	if err != nil {
+		return nil, err
+	}
+	caches := cache.SetupCaches(config, disableCache)
+	defer caches.Close()
+	nodes, err := actions.DecryptNodes([]*actions.File{&file}, caches, int(threads), retries, timeout, progress)
+	if err != nil {
+		return nil, err
+	}
+	return actions.FlattenSecrets(nodes, parsedPatterns, name)
+}
+
+func Export(stdout io.Writer, kind string, path string, name string, namespace string, patterns []string) error {
+	values, err := secretValues(path, patterns, actions.KubernetesKey)
+	if err != nil {
+		return err
+	}
+	manifest, err := actions.KubernetesManifest(kind, name, namespace, values)
+	if err != nil {
+		return err
+	}
+	e := yamlv3.NewEncoder(stdout)
+	e.SetIndent(2)
+	if err = e.Encode(&manifest); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	for _, cmd := range []*cobra.Command{exportSecretCmd, exportConfigMapCmd} {
+		exportCmd.AddCommand(cmd)
+		cmd.Flags().StringVarP(&exportFlags.name, "name", "", "", "name of the manifest")
+		cmd.Flags().StringVarP(&exportFlags.namespace, "namespace", "", "", "namespace of the manifest")
+		cmd.Flags().StringArrayVarP(&exportFlags.paths, "paths", "", nil, "only export values whose paths match this pattern, like db.* or **.password; can be given more than once")
+		cmd.MarkFlagRequired("name")
+	}
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+)
+
+const exportedSecret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+  namespace: prod
+type: Opaque
+data:
+  c: c2VjcmV0IDE=
+  d.2.a.c.d.e: c2VjcmV0IDI=
+  d.2.a.c.d.g: c2VjcmV0IDM=
+`
+
+func TestExport(t *testing.T) {
+	progress = false
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range repo.Files {
+			if file.Name != "nested_values" {
+				continue
+			}
+			var out bytes.Buffer
+			err = Export(&out, "Secret", file.TmpPath(repo.Provider), "app", "prod", []string{"c", "d.**"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != exportedSecret {
+				t.Errorf("Exported Secret from repo %s is incorrect:\n%s", repo, out.String())
+			}
+			// keys with spaces aren't allowed in a Secret
+			err = Export(&out, "Secret", file.TmpPath(repo.Provider), "app", "", nil)
+			if err == nil || !strings.Contains(err.Error(), "mixed list.2") {
+				t.Errorf("Exporting a value with an invalid key from repo %s should fail, got %v", repo, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var getFlags struct {
+	document   uint
+	json       bool
+	no_newline bool
+}
+
+var getCmd = &cobra.Command{
+	Use:                   "get <file> <path>",
+	Short:                 "Print a single value from an encrypted file.",
+	Long:                  "Print the value at a yaml path in an encrypted file, like db.password or \"mixed list\".2, decrypting only the ciphertexts it needs. Strings and other scalars are printed as they are, and mappings and sequences as yaml, or as JSON with --json.",
+	Args:                  cobra.ExactArgs(2),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return Get(os.Stdout, args[0], args[1], getFlags.document, getFlags.json, getFlags.no_newline)
+	},
+}
+
+func Get(stdout io.Writer, path string, valuePath string, document uint, asJSON bool, no_newline bool) error {
+	config, err := config.LoadConfig(".")
+	if err != nil {
+		return err
+	}
+	parsedPath, err := yaml.ParsePath(valuePath)
+	if err != nil {
+		return err
+	}
+	file, err := actions.NewStdoutFile(path, &config)
+	if err != nil {
+		return err
+	}
+	caches := cache.SetupCaches(config, disableCache)
+	defer caches.Close()
+	cache, err := caches.Get(file.ProviderName)
+	if err != nil {
+		return err
+	}
+	node, err := actions.GetNode(&file, int(document), parsedPath, cache, retries, timeout)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		yaml.StripTags(node, yaml.DecryptedTag)
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		return json.NewEncoder(stdout).Encode(value)
+	}
+	if node.Kind == yamlv3.ScalarNode {
+		value := node.Value
+		if yaml.HasTag(node, yaml.DecryptedTag) {
+			if value, err = yaml.GetValue(node); err != nil {
+				return err
+			}
+		}
+		io.WriteString(stdout, value)
+		if !no_newline {
+			io.WriteString(stdout, "\n")
+		}
+		return nil
+	}
+	yaml.StripTags(node, yaml.DecryptedTag)
+	e := yamlv3.NewEncoder(stdout)
+	e.SetIndent(2)
+	if err := e.Encode(node); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+	getCmd.Flags().UintVarP(&getFlags.document, "document", "", 0, "index of the yaml document the value is in, for files with several documents")
+	getCmd.Flags().BoolVarP(&getFlags.json, "json", "j", false, "print the value as JSON")
+	getCmd.Flags().BoolVarP(&getFlags.no_newline, "no-newline", "n", false, "do not print a trailing newline after strings and other scalars.")
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+)
+
+func TestGet(t *testing.T) {
+	progress = false
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path     string
+		json     bool
+		expected string
+	}{
+		{path: "c", expected: "secret 1\n"},
+		{path: "a", expected: "plain 1\n"},
+		{path: `"mixed list".4`, expected: "secret 5\n"},
+		{path: "d.2.a.c.d", expected: "e: secret 2\nf: plain 4\ng: secret 3\n"},
+		{path: "d.2.a.c.d", json: true, expected: `{"e":"secret 2","f":"plain 4","g":"secret 3"}` + "\n"},
+	}
+	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range repo.Files {
+			if file.Name != "nested_values" {
+				continue
+			}
+			for _, c := range cases {
+				var out bytes.Buffer
+				err := Get(&out, file.TmpPath(repo.Provider), c.path, 0, c.json, false)
+				if err != nil {
+					t.Fatalf("Error getting %s from repo %s: %v", c.path, repo, err)
+				}
+				if out.String() != c.expected {
+					t.Errorf("Value at %s from repo %s is incorrect: %q", c.path, repo, out.String())
+				}
+			}
+			for _, path := range []string{"missing", "d.3", "d.complex", "a.b"} {
+				var out bytes.Buffer
+				if err := Get(&out, file.TmpPath(repo.Provider), path, 0, false, false); err == nil {
+					t.Errorf("Getting %s from repo %s should fail", path, repo)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var gitDriversFlags struct {
+	dir     string
+	command string
+}
+
+var gitDriversCmd = &cobra.Command{
+	Use:   "install-git-drivers",
+	Short: "Set up git to show encrypted files decrypted in diffs.",
+	Long:  "Set up git diff and git log -p to show encrypted files decrypted, for anyone who can decrypt them, by adding the encrypted suffixes to the .gitattributes file, and configuring yaml-crypt textconv as their diff driver in the repo's local git config. Everyone who wants decrypted diffs needs to run this in their own clone.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := config.LoadConfig(gitDriversFlags.dir)
+		if err != nil {
+			return err
+		}
+		return actions.InstallGitDrivers(&config, gitDriversFlags.command)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gitDriversCmd)
+	gitDriversCmd.Flags().StringVarP(&gitDriversFlags.dir, "dir", "d", ".", "path to the root of the repo")
+	gitDriversCmd.Flags().StringVarP(&gitDriversFlags.command, "command", "", "yaml-crypt", "command git runs yaml-crypt with")
+}
@@ -13,8 +13,9 @@ import (
 )
 
 var initFlags struct {
-	provider string
-	dir      string
+	provider    string
+	dir         string
+	generateKey bool
 }
 
 // initCmd represents the init command
@@ -35,6 +36,9 @@ var initCmd = &cobra.Command{
 		if !ok {
 			return fmt.Errorf("Invalid provider name %s", strconv.Quote(initFlags.provider))
 		}
+		if initFlags.generateKey && initFlags.provider != "keyfile" {
+			return fmt.Errorf("--generate-key can only be used with the keyfile provider")
+		}
 		content := map[string]interface{}{
 			"provider": initFlags.provider,
 			"config":   providerConfig,
@@ -44,8 +48,18 @@ var initCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		// generate the key first, so a failure doesn't leave a config pointing at a key that doesn't exist
+		if initFlags.generateKey {
+			err = crypto.GenerateKeyfile(crypto.DefaultKeyfileName)
+			if err != nil {
+				return fmt.Errorf("Error generating key file %s: %w", crypto.DefaultKeyfileName, err)
+			}
+		}
 		err = ioutil.WriteFile(config.ConfigFilename, out, 0644)
 		if err != nil {
+			if initFlags.generateKey {
+				os.Remove(crypto.DefaultKeyfileName)
+			}
 			return err
 		}
 		config, err := config.LoadConfig(".")
@@ -62,4 +76,5 @@ func init() {
 	initCmd.Flags().StringVarP(&initFlags.provider, "provider", "p", "", "name of the provider to use")
 	initCmd.MarkFlagRequired("provider")
 	initCmd.Flags().StringVarP(&initFlags.dir, "dir", "d", ".", "path to the root of the repo")
+	initCmd.Flags().BoolVarP(&initFlags.generateKey, "generate-key", "", false, "generate a new key file (keyfile provider only)")
 }
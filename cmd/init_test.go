@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/crypto"
+)
+
+func TestInitExistingKey(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, crypto.DefaultKeyfileName)
+	if err := ioutil.WriteFile(keyPath, []byte("existing\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	initFlags.provider, initFlags.dir, initFlags.generateKey = "keyfile", dir, true
+	defer func() { initFlags.provider, initFlags.dir, initFlags.generateKey = "", ".", false }()
+	if err := initCmd.RunE(nil, []string{}); err == nil {
+		t.Fatal("Init with --generate-key should fail when the key file already exists")
+	}
+	if _, err := os.Stat(filepath.Join(dir, config.ConfigFilename)); !os.IsNotExist(err) {
+		t.Errorf("Failed init should not write %s", config.ConfigFilename)
+	}
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil || string(key) != "existing\n" {
+		t.Errorf("Failed init should leave the existing key file alone, got %q, %v", key, err)
+	}
+}
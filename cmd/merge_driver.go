@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var mergeDriverCmd = &cobra.Command{
+	Use:                   "merge-driver <base> <ours> <theirs> [path]",
+	Short:                 "Merge encrypted files value by value, as a git merge driver.",
+	Long:                  "Merge two versions of an encrypted file with a common ancestor, value by value, as a git merge driver set up by install-git-drivers. The merged file is written to <ours>, reusing the ciphertexts of values that didn't change. If values were changed in different ways on each side, ours' values are kept, the decrypted file for <path> is written with conflict markers around them, and this exits with an error.",
+	Args:                  cobra.RangeArgs(3, 4),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := ""
+		if len(args) == 4 {
+			path = args[3]
+		}
+		conflicts, err := MergeDriver(os.Stderr, args[0], args[1], args[2], path)
+		if err != nil {
+			return err
+		}
+		if conflicts {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+// Merge encrypted files, and report whether there were conflicts.
+func MergeDriver(stderr io.Writer, base string, ours string, theirs string, path string) (bool, error) {
+	config, err := config.LoadConfig(".")
+	if err != nil {
+		return false, err
+	}
+	caches := cache.SetupCaches(config, disableCache)
+	defer caches.Close()
+	conflicts, err := actions.MergeFiles(&config, base, ours, theirs, path, caches, int(threads), retries, timeout)
+	if err != nil {
+		return false, err
+	}
+	if len(conflicts) == 0 {
+		return false, nil
+	}
+	fmt.Fprintf(stderr, "Conflicting changes to %s at:\n", path)
+	for _, conflict := range conflicts {
+		fmt.Fprintf(stderr, "  %s\n", conflict.String())
+	}
+	if path != "" {
+		fmt.Fprintln(stderr, "Resolve them in the decrypted file, then run yaml-crypt encrypt.")
+	}
+	return true, nil
+}
+
+func init() {
+	rootCmd.AddCommand(mergeDriverCmd)
+}
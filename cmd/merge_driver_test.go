@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+)
+
+// Find the line of a file that starts with prefix, after trimming indentation.
+func lineWithPrefix(t *testing.T, path string, prefix string) string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), prefix) {
+			return line
+		}
+	}
+	t.Fatalf("No line in %s starts with %s", path, prefix)
+	return ""
+}
+
+func TestMergeDriver(t *testing.T) {
+	progress = false
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range repo.Files {
+			if file.Name != "nested_values" {
+				continue
+			}
+			path := file.TmpPath(repo.Provider)
+			original, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// git gives the driver temporary copies of each version
+			base, ours, theirs := filepath.Join(repo.TmpDir, "base"), filepath.Join(repo.TmpDir, "ours"), filepath.Join(repo.TmpDir, "theirs")
+			set := func(version string, valuePath string, value string) {
+				if err := Set(strings.NewReader(value), version, valuePath, true, true, "", 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			reset := func() {
+				for _, version := range []string{base, ours, theirs} {
+					if err := ioutil.WriteFile(version, original, 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			// changes to different values merge cleanly
+			reset()
+			set(ours, "c", "ours 1")
+			set(theirs, "d.2.a.c.d.e", "theirs 2")
+			set(theirs, "new.key", "theirs 3")
+			oursLine, theirsLine, baseLine := lineWithPrefix(t, ours, "c:"), lineWithPrefix(t, theirs, "e:"), lineWithPrefix(t, base, "g:")
+			var stderr bytes.Buffer
+			conflicts, err := MergeDriver(&stderr, base, ours, theirs, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conflicts {
+				t.Fatalf("Merge in repo %s should be clean:\n%s", repo, stderr.String())
+			}
+			// unchanged values keep their ciphertexts
+			if lineWithPrefix(t, ours, "c:") != oursLine || lineWithPrefix(t, ours, "e:") != theirsLine || lineWithPrefix(t, ours, "g:") != baseLine {
+				t.Errorf("Merge in repo %s should reuse existing ciphertexts", repo)
+			}
+			merged, err := ioutil.ReadFile(ours)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, merged, 0644); err != nil {
+				t.Fatal(err)
+			}
+			for valuePath, expected := range map[string]string{"c": "ours 1\n", "d.2.a.c.d.e": "theirs 2\n", "d.2.a.c.d.g": "secret 3\n", "new.key": "theirs 3\n"} {
+				var out bytes.Buffer
+				if err := Get(&out, path, valuePath, 0, false, false); err != nil {
+					t.Fatal(err)
+				}
+				if out.String() != expected {
+					t.Errorf("Merged value at %s in repo %s is incorrect: %q", valuePath, repo, out.String())
+				}
+			}
+
+			// changes to the same value conflict
+			if err := ioutil.WriteFile(path, original, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := DecryptCmd.RunE(nil, []string{path}); err != nil {
+				t.Fatal(err)
+			}
+			reset()
+			set(ours, "c", "ours 1")
+			set(theirs, "c", "theirs 1")
+			set(theirs, "d.2.a.c.d.e", "theirs 2")
+			stderr.Reset()
+			conflicts, err = MergeDriver(&stderr, base, ours, theirs, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !conflicts || !strings.Contains(stderr.String(), `0."c"`) {
+				t.Errorf("Merge in repo %s should conflict at c, got %q", repo, stderr.String())
+			}
+			decrypted, err := ioutil.ReadFile(file.TmpPath("original"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(decrypted), "<<<<<<< ours\nc: !secret ours 1\n=======\nc: !secret theirs 1\n>>>>>>> theirs\nd:\n") {
+				t.Errorf("Decrypted file with conflicts in repo %s is incorrect:\n%s", repo, decrypted)
+			}
+
+			// once git has written the result, the conflicts can be resolved in the decrypted file and encrypted
+			merged, err = ioutil.ReadFile(ours)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, merged, 0644); err != nil {
+				t.Fatal(err)
+			}
+			resolved := strings.Replace(string(decrypted), "<<<<<<< ours\nc: !secret ours 1\n=======\nc: !secret theirs 1\n>>>>>>> theirs\n", "c: !secret theirs 1\n", 1)
+			if err := ioutil.WriteFile(file.TmpPath("original"), []byte(resolved), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := EncryptCmd.RunE(nil, []string{path}); err != nil {
+				t.Fatalf("Encrypting resolved conflicts in repo %s failed: %s", repo, err)
+			}
+			for valuePath, expected := range map[string]string{"c": "theirs 1\n", "d.2.a.c.d.e": "theirs 2\n"} {
+				var out bytes.Buffer
+				if err := Get(&out, path, valuePath, 0, false, false); err != nil {
+					t.Fatal(err)
+				}
+				if out.String() != expected {
+					t.Errorf("Resolved value at %s in repo %s is incorrect: %q", valuePath, repo, out.String())
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var migrateFlags struct {
+	to string
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate --to <config file>",
+	Short: "Re-encrypt the whole repo with a new provider configuration, and switch to it.",
+	Long:  "Decrypt every encrypted file in the repo with the currently configured provider, encrypt them again with the provider configured in the given config file, and replace the repo's config file with it. The encrypted files and the config file are only replaced once everything has been re-encrypted, and the config file is replaced last, so an interrupted migration never leaves the repo unreadable. The new config must use the same suffixes as the current one.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		oldConfig, err := config.LoadConfig(".")
+		if err != nil {
+			return err
+		}
+		newConfigBytes, err := ioutil.ReadFile(migrateFlags.to)
+		if err != nil {
+			return err
+		}
+		newConfig, err := config.LoadConfigFile(migrateFlags.to, oldConfig.Root)
+		if err != nil {
+			return fmt.Errorf("Error loading new config %s: %w", migrateFlags.to, err)
+		}
+		if newConfig.Suffixes != oldConfig.Suffixes || newConfig.JSONSuffixes != oldConfig.JSONSuffixes || newConfig.DotenvSuffixes != oldConfig.DotenvSuffixes {
+			return errors.New("The new config must use the same suffixes as the current one")
+		}
+		paths, err := oldConfig.AllEncryptedFiles(oldConfig.Root)
+		if err != nil {
+			return err
+		}
+		sources := make([]*actions.File, len(paths))
+		targets := make([]*actions.File, len(paths))
+		for i, path := range paths {
+			source, err := actions.NewFile(path, &oldConfig)
+			if err != nil {
+				return err
+			}
+			target, err := actions.NewFile(path, &newConfig)
+			if err != nil {
+				return err
+			}
+			sources[i], targets[i] = &source, &target
+		}
+		values, err := func() (int, error) {
+			oldCaches := cache.SetupCaches(oldConfig, disableCache)
+			defer oldCaches.Close()
+			// the new ciphertexts are kept out of the existing caches, in case the migration fails
+			newCaches := cache.SetupCaches(newConfig, true)
+			defer newCaches.Close()
+			reencrypted, err := actions.Reencrypt(sources, targets, oldCaches, newCaches, int(threads), retries, timeout, progress)
+			if err != nil {
+				return 0, err
+			}
+			values := 0
+			for _, file := range reencrypted {
+				values += file.Values
+			}
+			return values, actions.SaveMigrated(reencrypted, filepath.Join(oldConfig.Root, config.ConfigFilename), newConfigBytes)
+		}()
+		if err != nil {
+			return err
+		}
+		// the existing cache is full of ciphertexts from the old provider, which shouldn't be reused
+		if err = cache.Remove(oldConfig); err != nil {
+			return err
+		}
+		if err = actions.UpdateGitignore(&newConfig); err != nil {
+			return err
+		}
+		fmt.Printf("Migrated %d values in %d files\n", values, len(paths))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().StringVarP(&migrateFlags.to, "to", "", "", "config file with the new provider configuration")
+	migrateCmd.MarkFlagRequired("to")
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/crypto"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// a config for the keyfile provider, using a key at the given path
+func keyfileConfig(repo fixtures.Repo, keyPath string) []byte {
+	return []byte(fmt.Sprintf(
+		"provider: keyfile\nconfig:\n  path: %s\nsuffixes:\n  encrypted: %s\n  decrypted: %s\n  plain: %s\n",
+		keyPath,
+		repo.Suffixes["encrypted"],
+		repo.Suffixes["decrypted"],
+		repo.Suffixes["plain"],
+	))
+}
+
+func TestMigrate(t *testing.T) {
+	progress = false
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		if repo.Provider != "keyfile" {
+			continue
+		}
+		DecryptFlags.Plain = false
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = crypto.GenerateKeyfile("new.key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		newConfig := keyfileConfig(repo, "new.key")
+		err = ioutil.WriteFile("new.yamlcrypt.yaml", newConfig, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = DecryptCmd.RunE(nil, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		migrateFlags.to = "new.yamlcrypt.yaml"
+		err = migrateCmd.RunE(nil, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the decrypted files are still known to be up to date, so changes to the encrypted files are still caught
+		path := repo.Files[0].TmpPath(repo.Provider)
+		encrypted, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, append(encrypted, []byte("# changed\n")...), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = EncryptCmd.RunE(nil, []string{path})
+		if err == nil || !strings.Contains(err.Error(), "has changed since") {
+			t.Errorf("Encrypting stale file in repo %s after migrating should be refused, got %v", repo, err)
+		}
+		err = ioutil.WriteFile(path, encrypted, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := ioutil.ReadFile(".yamlcrypt.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(config, newConfig) {
+			t.Errorf("Config file in repo %s was not replaced", repo)
+		}
+
+		// the files should now only be decryptable with the new key
+		err = os.Remove(".yamlcrypt.key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = DecryptCmd.RunE(nil, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		eq, err := repo.Compare("original")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !eq {
+			t.Errorf("Migrated files in repo %s decrypt incorrectly", repo)
+		}
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	progress = false
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		if repo.Provider != "keyfile" {
+			continue
+		}
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldConfig, err := ioutil.ReadFile(".yamlcrypt.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the new key doesn't exist, so encrypting with it fails
+		err = ioutil.WriteFile("new.yamlcrypt.yaml", keyfileConfig(repo, "missing.key"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		migrateFlags.to = "new.yamlcrypt.yaml"
+		err = migrateCmd.RunE(nil, []string{})
+		if err == nil {
+			t.Fatalf("Migrating repo %s to a missing key did not fail", repo)
+		}
+		config, err := ioutil.ReadFile(".yamlcrypt.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(config, oldConfig) {
+			t.Errorf("Config file in repo %s changed despite a failed migration", repo)
+		}
+		eq, err := repo.Compare(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !eq {
+			t.Errorf("Encrypted files in repo %s changed despite a failed migration", repo)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var rekeyFlags struct {
+	dryRun bool
+}
+
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey [file|directory]...",
+	Short: "Re-encrypt every encrypted value with a fresh ciphertext, eg. after rotating a key.",
+	Long:  "Re-encrypt every encrypted value in one or more encrypted files with a fresh ciphertext, using the provider as it's currently configured. Unlike encrypt, existing ciphertexts are never reused, so this is useful after rotating a key or changing the provider's key settings. Each arg can refer to either a file or a directory, in which case all encrypted files under the directory will be re-encrypted. Supplying no args will re-encrypt all encrypted files in the repo.",
+	Args:  cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := config.LoadConfig(".")
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			args = []string{config.Root}
+		}
+		files := make([]*actions.File, 0, len(args))
+		for _, arg := range args {
+			var paths []string
+			if info, err := os.Stat(arg); !os.IsNotExist(err) && info.IsDir() {
+				// if the arg is a dir, get all encrypted files in it
+				paths, err = config.AllEncryptedFiles(arg)
+				if err != nil {
+					return err
+				}
+			} else {
+				// otherwise, just let actions.NewFile figure it out later
+				paths = []string{arg}
+			}
+			for _, path := range paths {
+				file, err := actions.NewFile(path, &config)
+				if err != nil {
+					return err
+				}
+				files = append(files, &file)
+			}
+		}
+		if rekeyFlags.dryRun {
+			counts, err := actions.CountEncrypted(files)
+			if err != nil {
+				return err
+			}
+			values, changed := 0, 0
+			for i, count := range counts {
+				if count > 0 {
+					fmt.Printf("%s: %d values\n", files[i].EncryptedPath, count)
+					values += count
+					changed++
+				}
+			}
+			fmt.Printf("Would re-encrypt %d values in %d files\n", values, changed)
+			return nil
+		}
+		caches := cache.SetupCaches(config, disableCache)
+		defer caches.Close()
+		reencrypted, err := actions.Reencrypt(files, files, caches, caches, int(threads), retries, timeout, progress)
+		if err != nil {
+			return err
+		}
+		// files without any encrypted values are left alone
+		values := 0
+		changed := make([]actions.Reencrypted, 0, len(reencrypted))
+		for _, file := range reencrypted {
+			if file.Values > 0 {
+				values += file.Values
+				changed = append(changed, file)
+			}
+		}
+		if err = actions.SaveReencrypted(changed); err != nil {
+			return err
+		}
+		fmt.Printf("Re-encrypted %d values in %d files\n", values, len(changed))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rekeyCmd)
+	rekeyCmd.Flags().BoolVarP(&rekeyFlags.dryRun, "dry-run", "n", false, "only report how many values and files would be re-encrypted")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+	"io/ioutil"
+	"testing"
+)
+
+func TestRekey(t *testing.T) {
+	progress = false
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
+		DecryptFlags.Plain = false
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a dry run shouldn't change anything
+		rekeyFlags.dryRun = true
+		err = rekeyCmd.RunE(nil, []string{})
+		rekeyFlags.dryRun = false
+		if err != nil {
+			t.Fatal(err)
+		}
+		eq, err := repo.Compare(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !eq {
+			t.Errorf("Encrypted files in repo %s changed during a dry run", repo)
+		}
+
+		err = rekeyCmd.RunE(nil, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// every file with secrets should have fresh ciphertexts
+		for _, file := range repo.Files {
+			original, err := ioutil.ReadFile(file.SrcPath(repo.Provider))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(file.TmpPath(repo.Provider))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(original, []byte("!encrypted")) && bytes.Equal(data, original) {
+				t.Errorf("Encrypted file %s in repo %s did not change after rekey", file.TmpPath(repo.Provider), repo)
+			}
+		}
+
+		// and still decrypt to the same values
+		err = DecryptCmd.RunE(nil, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		eq, err = repo.Compare("original")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !eq {
+			t.Errorf("Rekeyed files in repo %s decrypt incorrectly", repo)
+		}
+	}
+}
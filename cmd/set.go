@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/generate"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	"github.com/spf13/cobra"
+)
+
+var setFlags struct {
+	stdin     bool
+	multiline bool
+	generate  string
+	document  uint
+}
+
+var setCmd = &cobra.Command{
+	Use:                   "set <file> <path> (--stdin | --generate <profile>)",
+	Short:                 "Encrypt a value and set it at a path in an encrypted file.",
+	Long:                  "Encrypt a value and set it at a yaml path in an encrypted file, like db.password, creating any mappings in the way. The value is read from STDIN with --stdin, or generated with --generate; it's never taken as an argument, so it doesn't end up in shell history or the process list. Nothing is decrypted, so this only needs permission to encrypt, and every other ciphertext and comment in the file is left exactly as it was.",
+	Args:                  cobra.ExactArgs(2),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return Set(os.Stdin, args[0], args[1], setFlags.stdin, setFlags.multiline, setFlags.generate, setFlags.document)
+	},
+}
+
+func Set(stdin io.Reader, path string, valuePath string, fromStdin bool, multiline bool, profile string, document uint) error {
+	if fromStdin == (profile != "") {
+		return errors.New("Exactly one of --stdin or --generate is required")
+	}
+	var plaintext string
+	var err error
+	switch {
+	case fromStdin && multiline:
+		var rawPlaintext []byte
+		if rawPlaintext, err = ioutil.ReadAll(stdin); err != nil {
+			return err
+		}
+		plaintext = string(rawPlaintext)
+	case fromStdin:
+		if plaintext, err = bufio.NewReader(stdin).ReadString('\n'); err != nil && err != io.EOF {
+			return err
+		}
+		plaintext = strings.TrimSuffix(plaintext, "\n")
+	default:
+		if plaintext, err = generate.Value(profile); err != nil {
+			return err
+		}
+	}
+	config, err := config.LoadConfig(".")
+	if err != nil {
+		return err
+	}
+	parsedPath, err := yaml.ParsePath(valuePath)
+	if err != nil {
+		return err
+	}
+	file, err := actions.NewStdoutFile(path, &config)
+	if err != nil {
+		return err
+	}
+	// generated plaintexts must never be written to the disk cache
+	caches := cache.SetupCaches(config, disableCache || profile != "")
+	defer caches.Close()
+	cache, err := caches.Get(file.ProviderName)
+	if err != nil {
+		return err
+	}
+	return actions.SetValue(&file, int(document), parsedPath, plaintext, cache, retries, timeout)
+}
+
+func init() {
+	rootCmd.AddCommand(setCmd)
+	setCmd.Flags().BoolVarP(&setFlags.stdin, "stdin", "", false, "read the value from STDIN, a single line unless --multi-line is given")
+	setCmd.Flags().BoolVarP(&setFlags.multiline, "multi-line", "m", false, "with --stdin, read multiple lines of input, stopping only at EOF.")
+	setCmd.Flags().StringVarP(&setFlags.generate, "generate", "g", "", "generate the value with this profile, like the !generate tag does")
+	setCmd.Flags().UintVarP(&setFlags.document, "document", "", 0, "index of the yaml document to set the value in, for files with several documents")
+}
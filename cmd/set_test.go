@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+)
+
+func TestSet(t *testing.T) {
+	progress = false
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range repo.Files {
+			if file.Name != "nested_values" {
+				continue
+			}
+			path := file.TmpPath(repo.Provider)
+			original, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// formatting yaml-crypt wouldn't write itself has to survive
+			quirky := "#   a   comment\n" + strings.Replace(string(original), "b: plain 2", "b:   'plain 2'   # odd", 1)
+			if err := ioutil.WriteFile(path, []byte(quirky), 0644); err != nil {
+				t.Fatal(err)
+			}
+			value := "new secret"
+			if err := Set(strings.NewReader(value), path, "d.2.a.c.d.e", true, true, "", 0); err != nil {
+				t.Fatalf("Error setting a value in repo %s: %v", repo, err)
+			}
+			if err := Set(strings.NewReader("from stdin\n"), path, "new.key", true, false, "", 0); err != nil {
+				t.Fatalf("Error setting a new value in repo %s: %v", repo, err)
+			}
+			updated, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldLines, newLines := strings.Split(quirky, "\n"), strings.Split(string(updated), "\n")
+			changed := 0
+			for i, line := range oldLines[:len(oldLines)-1] {
+				if line != newLines[i] {
+					changed++
+					if !strings.HasPrefix(newLines[i], "          e: !encrypted ") {
+						t.Errorf("Line %d in repo %s shouldn't have changed: %q", i, repo, newLines[i])
+					}
+				}
+			}
+			if changed != 1 || !strings.HasPrefix(strings.Join(newLines[len(oldLines)-1:], "\n"), "new:\n  key: !encrypted ") {
+				t.Errorf("Updated file in repo %s is incorrect:\n%s", repo, updated)
+			}
+			for path, expected := range map[string]string{"d.2.a.c.d.e": "new secret\n", "new.key": "from stdin\n", "c": "secret 1\n"} {
+				var out bytes.Buffer
+				if err := Get(&out, file.TmpPath(repo.Provider), path, 0, false, false); err != nil {
+					t.Fatal(err)
+				}
+				if out.String() != expected {
+					t.Errorf("Value at %s in repo %s is incorrect: %q", path, repo, out.String())
+				}
+			}
+			if err := Set(strings.NewReader(value), path, "a.b", true, true, "", 0); err == nil {
+				t.Errorf("Setting a value inside a string in repo %s should fail", repo)
+			}
+			// the value has to come from exactly one of --stdin or --generate
+			if err := Set(strings.NewReader(value), path, "c", false, false, "", 0); err == nil {
+				t.Errorf("Setting a value in repo %s without --stdin or --generate should fail", repo)
+			}
+			if err := Set(strings.NewReader(value), path, "c", true, false, "password", 0); err == nil {
+				t.Errorf("Setting a value in repo %s with both --stdin and --generate should fail", repo)
+			}
+		}
+	}
+}
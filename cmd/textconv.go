@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var textconvCmd = &cobra.Command{
+	Use:                   "textconv <file>",
+	Short:                 "Print an encrypted file decrypted, for git diff.",
+	Long:                  "Print an encrypted file decrypted, for git to show in diffs. Set this up with install-git-drivers. If the file can't be decrypted, it's printed as it is, with a warning.",
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return Textconv(os.Stdout, os.Stderr, args[0])
+	},
+}
+
+func Textconv(stdout io.Writer, stderr io.Writer, path string) error {
+	err := func() error {
+		config, err := config.LoadConfig(".")
+		if err != nil {
+			return err
+		}
+		files, err := actions.TextconvFiles(path, &config)
+		if err != nil {
+			return err
+		}
+		caches := cache.SetupCaches(config, disableCache)
+		defer caches.Close()
+		// only one of the files it could be will decrypt, if its ciphertexts are bound to its path
+		for _, file := range files {
+			var nodes []yamlv3.Node
+			nodes, err = actions.DecryptNodes([]*actions.File{file}, caches, int(threads), retries, timeout, false)
+			if err == nil {
+				return yaml.Write(stdout, path, nodes[0])
+			}
+		}
+		return err
+	}()
+	if err == nil {
+		return nil
+	}
+	// git can still show the diff of the encrypted file
+	fmt.Fprintf(stderr, "yaml-crypt: showing %s encrypted: %v\n", path, err)
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(contents)
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(textconvCmd)
+}
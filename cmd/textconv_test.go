@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+)
+
+func TestTextconv(t *testing.T) {
+	progress = false
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		if repo.Skip() {
+			continue
+		}
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Checkout(repo.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range repo.Files {
+			expected, err := ioutil.ReadFile(file.SrcPath("original"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// git gives textconv the file in the working tree, or a copy of older versions outside of the repo
+			copied := filepath.Join(t.TempDir(), filepath.Base(file.TmpPath(repo.Provider)))
+			encrypted, err := ioutil.ReadFile(file.TmpPath(repo.Provider))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(copied, encrypted, 0600); err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range []string{file.TmpPath(repo.Provider), copied} {
+				var out, stderr bytes.Buffer
+				if err := Textconv(&out, &stderr, path); err != nil {
+					t.Fatal(err)
+				}
+				if out.String() != string(expected) {
+					t.Errorf("textconv of %s in repo %s is incorrect:\n%s%s", path, repo, out.String(), stderr.String())
+				}
+			}
+		}
+		// a file that can't be decrypted is shown as it is
+		broken := filepath.Join(repo.TmpDir, "broken."+repo.Suffixes["encrypted"])
+		contents := "a: !encrypted bm90IGEgY2lwaGVydGV4dA==\n"
+		if err := ioutil.WriteFile(broken, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		var out, stderr bytes.Buffer
+		if err := Textconv(&out, &stderr, broken); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != contents || !strings.Contains(stderr.String(), "broken") {
+			t.Errorf("textconv of a broken file in repo %s should print it as it is, with a warning, got %q, %q", repo, out.String(), stderr.String())
+		}
+		os.Remove(broken)
+	}
+}
+
+func TestInstallGitDrivers(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		err := repo.Setup()
+		defer repo.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, "init", "-q")
+		c, err := config.LoadConfig(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// running it twice doesn't add anything twice
+		for i := 0; i < 2; i++ {
+			if err := actions.InstallGitDrivers(&c, "yaml-crypt"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		attributes, err := ioutil.ReadFile(".gitattributes")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "*." + repo.Suffixes["encrypted"] + " diff=yaml-crypt\n*." + repo.Suffixes["encrypted"] + " merge=yaml-crypt\n"; string(attributes) != expected {
+			t.Errorf(".gitattributes in repo %s is incorrect: %q", repo, attributes)
+		}
+		textconv, err := exec.Command("git", "config", "diff.yaml-crypt.textconv").Output()
+		if err != nil || string(textconv) != "yaml-crypt textconv\n" {
+			t.Errorf("textconv driver in repo %s is incorrect: %q, %v", repo, textconv, err)
+		}
+		driver, err := exec.Command("git", "config", "merge.yaml-crypt.driver").Output()
+		if err != nil || string(driver) != "yaml-crypt merge-driver %O %A %B %P\n" {
+			t.Errorf("merge driver in repo %s is incorrect: %q, %v", repo, driver, err)
+		}
+	}
+}
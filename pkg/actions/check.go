@@ -0,0 +1,229 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// A class of problem found by Check. Each has its own bit in the exit code of yaml-crypt check.
+type CheckClass struct {
+	Name     string
+	ExitCode int
+}
+
+var (
+	// A decrypted or plain file is tracked by git.
+	TrackedPlaintext = CheckClass{Name: "tracked-plaintext", ExitCode: 2}
+	// An encrypted file has a value tagged !secret, or an unencrypted value that the config's secret rules or kubernetesSecrets make a secret.
+	UnencryptedSecret = CheckClass{Name: "unencrypted-secret", ExitCode: 4}
+	// An encrypted file has a value tagged !generate.
+	UnresolvedGenerate = CheckClass{Name: "unresolved-generate", ExitCode: 8}
+	// An encrypted file has a value tagged !encrypted that isn't a valid base64 ciphertext.
+	InvalidCiphertext = CheckClass{Name: "invalid-ciphertext", ExitCode: 16}
+	// An encrypted file can't be read.
+	InvalidFile = CheckClass{Name: "invalid-file", ExitCode: 32}
+)
+
+// A problem found by Check, in a file relative to the root of the repo, and at a path in it, if it's about a single value.
+type CheckFailure struct {
+	Class   CheckClass
+	File    string
+	Path    string
+	Message string
+}
+
+// The files checked by Check, relative to the root of the repo, and the problems found in them.
+type CheckResult struct {
+	Files    []string
+	Failures []CheckFailure
+}
+
+// The exit code for the problems found: the bits of each class of problem found, combined.
+func (r CheckResult) ExitCode() int {
+	code := 0
+	for _, failure := range r.Failures {
+		code |= failure.Class.ExitCode
+	}
+	return code
+}
+
+// Check that no decrypted or plain file is tracked by git, and that every encrypted file in the repo is fully encrypted, with valid ciphertexts.
+func Check(c *config.Config) (CheckResult, error) {
+	var result CheckResult
+	tracked, err := git(c, "ls-files", "-z")
+	if err != nil {
+		return result, err
+	}
+	for _, name := range strings.Split(string(tracked), "\x00") {
+		if name != "" && c.IsPlaintextFile(name) {
+			result.Files = append(result.Files, name)
+			result.Failures = append(result.Failures, CheckFailure{Class: TrackedPlaintext, File: name, Message: "Decrypted and plain files must never be committed, but this one is tracked by git"})
+		}
+	}
+	paths, err := c.AllEncryptedFiles(c.Root)
+	if err != nil {
+		return result, err
+	}
+	for _, path := range paths {
+		name, err := filepath.Rel(c.Root, path)
+		if err != nil {
+			return result, err
+		}
+		name = filepath.ToSlash(name)
+		file, err := NewFile(path, c)
+		if err != nil {
+			return result, err
+		}
+		result.Files = append(result.Files, name)
+		result.Failures = append(result.Failures, checkEncryptedFile(&file, name)...)
+	}
+	return result, nil
+}
+
+// Check that an encrypted file is fully encrypted, with valid ciphertexts.
+func checkEncryptedFile(file *File, name string) []CheckFailure {
+	node, err := yaml.ReadFile(file.EncryptedPath)
+	if err != nil {
+		return []CheckFailure{{Class: InvalidFile, File: name, Message: fmt.Sprintf("Error reading yaml file: %v", err)}}
+	}
+	var out []CheckFailure
+	tagged := map[string]bool{}
+	for child := range yaml.GetTaggedChildren(&node, yaml.DecryptedTag) {
+		tagged[child.Path.String()] = true
+		out = append(out, CheckFailure{Class: UnencryptedSecret, File: name, Path: child.Path.String(), Message: "Value tagged " + child.YamlNode.Tag + " isn't encrypted"})
+	}
+	// tag the values that encrypt would treat as secrets even though they aren't tagged, like it does
+	yaml.TagMatching(&node, file.SecretPaths, yaml.DecryptedTag)
+	if file.KubernetesSecrets {
+		if err = yaml.TagKubernetesSecrets(&node); err != nil {
+			out = append(out, CheckFailure{Class: InvalidFile, File: name, Message: fmt.Sprintf("Error tagging Kubernetes Secret values: %v", err)})
+		}
+	}
+	for child := range yaml.GetTaggedChildren(&node, yaml.DecryptedTag) {
+		if !tagged[child.Path.String()] {
+			out = append(out, CheckFailure{Class: UnencryptedSecret, File: name, Path: child.Path.String(), Message: "Value is a secret by the config, but isn't encrypted"})
+		}
+	}
+	for child := range yaml.GetTaggedChildren(&node, yaml.GenerateTag) {
+		out = append(out, CheckFailure{Class: UnresolvedGenerate, File: name, Path: child.Path.String(), Message: "Value tagged " + yaml.GenerateTag + " hasn't been generated and encrypted"})
+	}
+	for child := range yaml.GetTaggedChildren(&node, yaml.EncryptedTag) {
+		if message := checkCiphertext(child.YamlNode); message != "" {
+			out = append(out, CheckFailure{Class: InvalidCiphertext, File: name, Path: child.Path.String(), Message: message})
+		}
+	}
+	return out
+}
+
+// Check that a value tagged !encrypted is a valid base64 ciphertext, and describe the problem if it isn't.
+func checkCiphertext(node *yamlv3.Node) string {
+	if node.Kind != yamlv3.ScalarNode {
+		return "Value tagged " + node.Tag + " isn't a string"
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(node.Value)
+	if err != nil {
+		return fmt.Sprintf("Value tagged %s isn't valid base64: %v", node.Tag, err)
+	}
+	if len(ciphertext) == 0 {
+		return "Value tagged " + node.Tag + " is empty"
+	}
+	return ""
+}
+
+// Write the problems found, one per line, followed by a summary.
+func (r CheckResult) WriteText(w io.Writer) error {
+	var b bytes.Buffer
+	for _, failure := range r.Failures {
+		location := failure.File
+		if failure.Path != "" {
+			location += " " + failure.Path
+		}
+		fmt.Fprintf(&b, "%s: %s: %s\n", location, failure.Class.Name, failure.Message)
+	}
+	fmt.Fprintf(&b, "Checked %d files, found %d problems\n", len(r.Files), len(r.Failures))
+	_, err := b.WriteTo(w)
+	return err
+}
+
+type checkJSONFailure struct {
+	Class   string `json:"class"`
+	File    string `json:"file"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// Write the files checked and the problems found as a JSON object.
+func (r CheckResult) WriteJSON(w io.Writer) error {
+	out := struct {
+		Files    []string           `json:"files"`
+		Failures []checkJSONFailure `json:"failures"`
+		ExitCode int                `json:"exitCode"`
+	}{Files: r.Files, Failures: []checkJSONFailure{}, ExitCode: r.ExitCode()}
+	if out.Files == nil {
+		out.Files = []string{}
+	}
+	for _, failure := range r.Failures {
+		out.Failures = append(out.Failures, checkJSONFailure{Class: failure.Class.Name, File: failure.File, Path: failure.Path, Message: failure.Message})
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(out)
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string         `xml:"classname,attr"`
+	Name      string         `xml:"name,attr"`
+	Failures  []junitFailure `xml:"failure"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// Write the files checked and the problems found as a JUnit XML report, with a test case for each file.
+func (r CheckResult) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{Name: "yaml-crypt check", Tests: len(r.Files)}
+	cases := map[string]int{}
+	for _, file := range r.Files {
+		cases[file] = len(suite.TestCases)
+		suite.TestCases = append(suite.TestCases, junitTestCase{ClassName: "yaml-crypt check", Name: file})
+	}
+	for _, failure := range r.Failures {
+		message := failure.Message
+		if failure.Path != "" {
+			message = failure.Path + ": " + message
+		}
+		testCase := &suite.TestCases[cases[failure.File]]
+		if len(testCase.Failures) == 0 {
+			suite.Failures++
+		}
+		testCase.Failures = append(testCase.Failures, junitFailure{Type: failure.Class.Name, Message: message})
+	}
+	out, err := xml.MarshalIndent(struct {
+		XMLName xml.Name         `xml:"testsuites"`
+		Suites  []junitTestSuite `xml:"testsuite"`
+	}{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header+string(out)+"\n")
+	return err
+}
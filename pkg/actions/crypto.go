@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,31 +18,19 @@ import (
 
 type nothing struct{}
 
-func Decrypt(files []*File, plain bool, stdout bool, json bool, cache cache.Cache, provider *crypto.Provider, threads int, retries uint, timeout time.Duration, progress bool) error {
-	// read in files, populate the set of ciphertexts
-	nodes := make([]yamlv3.Node, len(files))
-	ciphertextSet := map[string]nothing{}
-	for i, file := range files {
-		if node, err := yaml.ReadFile(file.EncryptedPath); err != nil {
-			return fmt.Errorf("Error reading yaml file %s: %w", file.DecryptedPath, err)
-		} else {
-			nodes[i] = node
-		}
-		if err := addTaggedValuesToSet(&ciphertextSet, &nodes[i], yaml.EncryptedTag); err != nil {
-			return fmt.Errorf("Error getting encrypted values from file %s: %w", file.EncryptedPath, err)
-		}
-	}
-	// fill in the cache with decryptions of all ciphertexts in the set
-	if err := decryptCiphertexts(&ciphertextSet, cache, provider, threads, retries, timeout, progress); err != nil {
-		return fmt.Errorf("Error decrypting existing ciphertexts: %w", err)
+// A plaintext or ciphertext, along with the additional authenticated data it's bound to, if any.
+type item struct {
+	value string
+	aad   string
+}
+
+// Decrypt files, grouped by the providers they're encrypted with, each using its own cache, and write them out.
+func Decrypt(files []*File, plain bool, stdout bool, json bool, caches *cache.Caches, threads int, retries uint, timeout time.Duration, progress bool) error {
+	nodes, err := DecryptNodes(files, caches, threads, retries, timeout, progress)
+	if err != nil {
+		return err
 	}
 	for i, file := range files {
-		// decrypt encrypted child nodes using now-loaded cache
-		for node := range yaml.GetTaggedChildren(&nodes[i], yaml.EncryptedTag) {
-			if err := yaml.DecryptNode(node.YamlNode, cache); err != nil {
-				return fmt.Errorf("Error decrypting node %s using cache: %w", node.Path.String(), err)
-			}
-		}
 		// Determine output path
 		out := ""
 		if stdout {
@@ -61,8 +50,16 @@ func Decrypt(files []*File, plain bool, stdout bool, json bool, cache cache.Cach
 				return fmt.Errorf("Error writing JSON: %w", err)
 			}
 			return nil
+		} else if stdout {
+			if err := yaml.Write(os.Stdout, file.EncryptedPath, nodes[i]); err != nil {
+				return fmt.Errorf("Error writing to stdout: %w", err)
+			}
 		} else if err := yaml.SaveFile(out, nodes[i]); err != nil {
 			return fmt.Errorf("Error writing yaml file %s: %w", out, err)
+		} else if !plain {
+			if err := recordFingerprint(file); err != nil {
+				return err
+			}
 		}
 		// if this is a regular decrypt operation and a plain file exists,
 		// update it too.
@@ -76,13 +73,116 @@ func Decrypt(files []*File, plain bool, stdout bool, json bool, cache cache.Cach
 	return nil
 }
 
-func Encrypt(files []*File, cache cache.Cache, provider *crypto.Provider, threads int, retries uint, timeout time.Duration, progress bool, noCache bool) error {
+// Decrypt files in memory, grouped by the providers they're encrypted with, each using its own cache. The decrypted contents of each file are returned with their values tagged !secret, and nothing is written.
+func DecryptNodes(files []*File, caches *cache.Caches, threads int, retries uint, timeout time.Duration, progress bool) ([]yamlv3.Node, error) {
+	nodes := make([]yamlv3.Node, len(files))
+	for i, file := range files {
+		node, err := yaml.ReadFile(file.EncryptedPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading yaml file %s: %w", file.EncryptedPath, err)
+		}
+		nodes[i] = node
+	}
+	if err := DecryptRead(files, nodes, caches, threads, retries, timeout, progress); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// Decrypt the contents of files that have already been read, in place, like DecryptNodes does. This is for contents that don't come from the files' EncryptedPaths, like older revisions in git.
+func DecryptRead(files []*File, nodes []yamlv3.Node, caches *cache.Caches, threads int, retries uint, timeout time.Duration, progress bool) error {
+	for _, group := range groupByProvider(files) {
+		groupFiles := pick(files, group)
+		groupNodes := make([]*yamlv3.Node, len(group))
+		for j, i := range group {
+			groupNodes[j] = &nodes[i]
+		}
+		cache, err := caches.Get(groupFiles[0].ProviderName)
+		if err != nil {
+			return err
+		}
+		if err := decryptNodes(groupFiles, groupNodes, cache, &groupFiles[0].Provider, threads, retries, timeout, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encrypt files, grouped by the providers they're encrypted with, each using its own cache. Unless force is set, nothing is encrypted if any of the encrypted files has changed since its decrypted file was produced.
+func Encrypt(files []*File, caches *cache.Caches, threads int, retries uint, timeout time.Duration, progress bool, noCache bool, force bool) error {
+	if !force {
+		if err := checkStale(files); err != nil {
+			return err
+		}
+	}
+	for _, group := range groupByProvider(files) {
+		groupFiles := pick(files, group)
+		cache, err := caches.Get(groupFiles[0].ProviderName)
+		if err != nil {
+			return err
+		}
+		if err = encryptFiles(groupFiles, cache, &groupFiles[0].Provider, threads, retries, timeout, progress, noCache); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Group the indices of files by the files' providers, keeping the order they were given in.
+func groupByProvider(files []*File) [][]int {
+	var groups [][]int
+	indices := map[string]int{}
+	for i, file := range files {
+		g, ok := indices[file.ProviderName]
+		if !ok {
+			g = len(groups)
+			indices[file.ProviderName] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// Get the files at the given indices.
+func pick(files []*File, indices []int) []*File {
+	out := make([]*File, len(indices))
+	for j, i := range indices {
+		out[j] = files[i]
+	}
+	return out
+}
+
+func decryptNodes(files []*File, nodes []*yamlv3.Node, cache cache.Cache, provider *crypto.Provider, threads int, retries uint, timeout time.Duration, progress bool) error {
+	// populate the set of ciphertexts
+	ciphertextSet := map[item]nothing{}
+	for i, file := range files {
+		if err := addTaggedValuesToSet(&ciphertextSet, nodes[i], yaml.EncryptedTag, file); err != nil {
+			return fmt.Errorf("Error getting encrypted values from file %s: %w", file.EncryptedPath, err)
+		}
+	}
+	// fill in the cache with decryptions of all ciphertexts in the set
+	if err := decryptCiphertexts(&ciphertextSet, cache, provider, threads, retries, timeout, progress); err != nil {
+		return fmt.Errorf("Error decrypting existing ciphertexts: %w", err)
+	}
+	for i, file := range files {
+		// decrypt encrypted child nodes using now-loaded cache
+		for node := range yaml.GetTaggedChildren(nodes[i], yaml.EncryptedTag) {
+			if err := yaml.DecryptNode(node.YamlNode, file.AAD(node.Path.String(), node.YamlNode.Tag), cache); err != nil {
+				return fmt.Errorf("Error decrypting node %s using cache: %w", node.Path.String(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func encryptFiles(files []*File, cache cache.Cache, provider *crypto.Provider, threads int, retries uint, timeout time.Duration, progress bool, noCache bool) error {
 	// read in decrypted files, populate the set of plaintexts
 	var err error
 	decryptedNodes := make([]yamlv3.Node, len(files))
 	ciphertextPathMaps := make([]map[string]string, len(files))
-	ciphertextSet := map[string]nothing{}
-	plaintextSet := map[string]nothing{}
+	ciphertextSet := map[item]nothing{}
+	plaintextSet := map[item]nothing{}
 	for i, file := range files {
 		decryptedNodes[i], err = yaml.ReadFile(file.DecryptedPath)
 		if err != nil {
@@ -99,7 +199,7 @@ func Encrypt(files []*File, cache cache.Cache, provider *crypto.Provider, thread
 			if err != nil {
 				return fmt.Errorf("Error getting encrypted values from file %s: %w", file.EncryptedPath, err)
 			}
-			err = addTaggedValuesToSet(&ciphertextSet, &node, yaml.EncryptedTag)
+			err = addTaggedValuesToSet(&ciphertextSet, &node, yaml.EncryptedTag, file)
 			if err != nil {
 				return fmt.Errorf("Error getting encrypted values from file %s: %w", file.EncryptedPath, err)
 			}
@@ -108,8 +208,15 @@ func Encrypt(files []*File, cache cache.Cache, provider *crypto.Provider, thread
 		if err = resolveGeneratedNodes(&decryptedNodes[i], ciphertextPathMaps[i], noCache); err != nil {
 			return fmt.Errorf("Error resolving generated values in file %s: %w", file.DecryptedPath, err)
 		}
+		// values matching the config's secret rules are secrets, even if they aren't tagged.
+		yaml.TagMatching(&decryptedNodes[i], file.SecretPaths, yaml.DecryptedTag)
+		if file.KubernetesSecrets {
+			if err = yaml.TagKubernetesSecrets(&decryptedNodes[i]); err != nil {
+				return fmt.Errorf("Error tagging Kubernetes Secret values in file %s: %w", file.DecryptedPath, err)
+			}
+		}
 		// collect plaintexts to encrypt, now including any freshly generated values.
-		err = addTaggedValuesToSet(&plaintextSet, &decryptedNodes[i], yaml.DecryptedTag)
+		err = addTaggedValuesToSet(&plaintextSet, &decryptedNodes[i], yaml.DecryptedTag, file)
 		if err != nil {
 			return fmt.Errorf("Error getting decrypted values from file %s: %w", file.DecryptedPath, err)
 		}
@@ -134,8 +241,9 @@ func Encrypt(files []*File, cache cache.Cache, provider *crypto.Provider, thread
 	for i, file := range files {
 		// encrypt decrypted child nodes using now-loaded cache
 		for node := range yaml.GetTaggedChildren(&decryptedNodes[i], yaml.DecryptedTag) {
-			possibleCiphertext, _ := ciphertextPathMaps[i][node.Path.String()]
-			err = yaml.EncryptNode(node.YamlNode, []byte(possibleCiphertext), cache)
+			path := node.Path.String()
+			possibleCiphertext, _ := ciphertextPathMaps[i][path]
+			err = yaml.EncryptNode(node.YamlNode, file.AAD(path, yaml.EncryptedTagOf(node.YamlNode)), []byte(possibleCiphertext), cache)
 			if err != nil {
 				return fmt.Errorf("Error encrypting node %s using cache: %w", node.Path.String(), err)
 			}
@@ -145,6 +253,9 @@ func Encrypt(files []*File, cache cache.Cache, provider *crypto.Provider, thread
 		if err != nil {
 			return fmt.Errorf("Error writing yaml file %s: %w", file.EncryptedPath, err)
 		}
+		if err = recordFingerprint(file); err != nil {
+			return err
+		}
 	}
 	return err
 }
@@ -181,82 +292,100 @@ func resolveGeneratedNodes(node *yamlv3.Node, existingCiphertextByPath map[strin
 	return nil
 }
 
-func addTaggedValuesToSet(set *map[string]nothing, node *yamlv3.Node, tag string) (err error) {
-	values, err := yaml.GetTaggedChildrenValues(node, tag)
-	if err != nil {
-		return
-	}
-	for _, value := range values {
-		(*set)[value] = nothing{}
+// Add the values of a file's descendents of node tagged with the given tag to set, along with the additional authenticated data they're bound to.
+func addTaggedValuesToSet(set *map[item]nothing, node *yamlv3.Node, tag string, file *File) error {
+	for n := range yaml.GetTaggedChildren(node, tag) {
+		value, err := yaml.GetValue(n.YamlNode)
+		if err != nil {
+			return err
+		}
+		(*set)[item{value: value, aad: string(file.AAD(n.Path.String(), yaml.EncryptedTagOf(n.YamlNode)))}] = nothing{}
 	}
-	return
+	return nil
 }
 
-func encryptPlaintexts(set *map[string]nothing, cache cache.Cache, provider *crypto.Provider, threads int, retries uint, timeout time.Duration, progress bool) error {
-	plaintexts := make([]string, 0, len(*set))
+func setItems(set *map[item]nothing) []item {
+	items := make([]item, 0, len(*set))
 	for k := range *set {
-		plaintexts = append(plaintexts, k)
+		items = append(items, k)
 	}
-	_, err := parallelMap(plaintexts, func(plaintext string) (string, error) {
-		_, err := EncryptPlaintext(plaintext, cache, provider, retries, timeout)
-		return "", err
+	return items
+}
+
+func encryptPlaintexts(set *map[item]nothing, cache cache.Cache, provider *crypto.Provider, threads int, retries uint, timeout time.Duration, progress bool) error {
+	return parallelEach(setItems(set), func(plaintext item) error {
+		_, err := EncryptPlaintext(plaintext.value, []byte(plaintext.aad), cache, provider, retries, timeout)
+		return err
 	}, threads, progress)
-	return err
 }
 
-func EncryptPlaintext(plaintext string, cache cache.Cache, provider *crypto.Provider, retries uint, timeout time.Duration) ([]byte, error) {
-	ciphertext, ok, err := cache.Encrypt(plaintext, []byte{})
+// Encrypt a plaintext, bound to the given additional authenticated data if it isn't empty, reusing a cached ciphertext if possible.
+func EncryptPlaintext(plaintext string, aad []byte, cache cache.Cache, provider *crypto.Provider, retries uint, timeout time.Duration) ([]byte, error) {
+	ciphertext, ok, err := cache.Encrypt(plaintext, aad, []byte{})
 	if err != nil {
 		return []byte{}, fmt.Errorf("Error looking up plaintext in cache: %w", err)
 	}
 	if ok {
 		return ciphertext, nil
 	}
-	ciphertext, err = (*provider).Encrypt(plaintext, retries, timeout)
+	ciphertext, err = crypto.Encrypt(*provider, plaintext, aad, retries, timeout)
 	if err != nil {
 		return []byte{}, fmt.Errorf("Error using provider to encrypt plaintext: %w", err)
 	}
-	err = cache.Add(plaintext, ciphertext)
+	err = cache.Add(plaintext, aad, ciphertext)
 	if err != nil {
 		return []byte{}, fmt.Errorf("Error adding item to cache: %w", err)
 	}
 	return ciphertext, nil
 }
 
-func decryptCiphertexts(set *map[string]nothing, cache cache.Cache, provider *crypto.Provider, threads int, retries uint, timeout time.Duration, progress bool) error {
-	ciphertexts := make([]string, 0, len(*set))
-	for k := range *set {
-		ciphertexts = append(ciphertexts, k)
-	}
-	_, err := parallelMap(ciphertexts, func(ciphertext string) (string, error) {
-		_, err := DecryptCiphertext([]byte(ciphertext), cache, provider, retries, timeout)
-		return "", err
+func decryptCiphertexts(set *map[item]nothing, cache cache.Cache, provider *crypto.Provider, threads int, retries uint, timeout time.Duration, progress bool) error {
+	return parallelEach(setItems(set), func(ciphertext item) error {
+		_, err := DecryptCiphertext([]byte(ciphertext.value), []byte(ciphertext.aad), cache, provider, retries, timeout)
+		return err
 	}, threads, progress)
-	return err
 }
 
-func DecryptCiphertext(ciphertext []byte, cache cache.Cache, provider *crypto.Provider, retries uint, timeout time.Duration) (string, error) {
-	plaintext, ok, err := cache.Decrypt(ciphertext)
+// Decrypt a ciphertext, checking that it's bound to the given additional authenticated data if it isn't empty, using the cached plaintext if possible.
+func DecryptCiphertext(ciphertext []byte, aad []byte, cache cache.Cache, provider *crypto.Provider, retries uint, timeout time.Duration) (string, error) {
+	plaintext, ok, err := cache.Decrypt(ciphertext, aad)
 	if err != nil {
 		return "", fmt.Errorf("Error looking up ciphertext in cache: %w", err)
 	}
 	if ok {
 		return plaintext, nil
 	}
-	plaintext, err = (*provider).Decrypt(ciphertext, retries, timeout)
-	if err != nil {
+	plaintext, err = crypto.Decrypt(*provider, ciphertext, aad, retries, timeout)
+	if err != nil && len(aad) > 0 {
+		return "", fmt.Errorf("Error using provider to decrypt ciphertext bound to %s (it may have been moved there from another path or file, or had its type changed): %w", describeAAD(aad), err)
+	} else if err != nil {
 		return "", fmt.Errorf("Error using provider to decrypt ciphertext: %w", err)
 	}
-	err = cache.Add(plaintext, ciphertext)
+	err = cache.Add(plaintext, aad, ciphertext)
 	if err != nil {
 		return "", fmt.Errorf("Error adding item to cache: %w", err)
 	}
 	return plaintext, nil
 }
 
-func parallelMap(inputs []string, function func(string) (string, error), threads int, progress bool) (outputs map[string]string, err error) {
-	inputChannel := make(chan string)
-	outputChannel := make(chan mapResult)
+// Describe the file, path and tag given by a File's AAD, for error messages.
+func describeAAD(aad []byte) string {
+	s := string(aad)
+	i := strings.LastIndex(s, "\n")
+	if i == -1 {
+		return strconv.Quote(s)
+	}
+	s, tag := s[:i], s[i+1:]
+	j := strings.LastIndex(s, "\n")
+	if j == -1 {
+		return strconv.Quote(string(aad))
+	}
+	return fmt.Sprintf("path %s in file %s as %s", s[j+1:], strconv.Quote(s[:j]), tag)
+}
+
+func parallelEach(inputs []item, function func(item) error, threads int, progress bool) (err error) {
+	inputChannel := make(chan item)
+	outputChannel := make(chan error)
 	var bar *progressbar.ProgressBar
 	if progress {
 		bar = progressbar.NewOptions(
@@ -267,13 +396,11 @@ func parallelMap(inputs []string, function func(string) (string, error), threads
 			progressbar.OptionSetWriter(os.Stderr),
 		)
 	}
-	outputs = map[string]string{}
 	// spin up workers
 	for i := 0; i < threads; i++ {
 		go func() {
 			for input := range inputChannel {
-				output, err := function(input)
-				outputChannel <- mapResult{input, output, err}
+				outputChannel <- function(input)
 			}
 		}()
 	}
@@ -285,12 +412,10 @@ func parallelMap(inputs []string, function func(string) (string, error), threads
 	}()
 	// consume results
 	for i := 0; i < len(inputs); i++ {
-		result := <-outputChannel
-		err = result.err
+		err = <-outputChannel
 		if err != nil {
 			return
 		}
-		outputs[result.input] = result.output
 		if progress {
 			bar.Add(1)
 		}
@@ -302,9 +427,3 @@ func parallelMap(inputs []string, function func(string) (string, error), threads
 	close(outputChannel)
 	return
 }
-
-type mapResult struct {
-	input  string
-	output string
-	err    error
-}
@@ -0,0 +1,538 @@
+package actions_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/crypto"
+)
+
+const bindDoc = `db:
+  password: !secret hunter2
+  user: !secret admin
+`
+
+// bindRepo returns a config for a repo in a temporary directory with bindPaths enabled, and the File for an encrypted file in it.
+func bindRepo(t *testing.T) (config.Config, actions.File) {
+	t.Helper()
+	c := config.Config{
+		Provider: crypto.KeyfileProvider{Key: bytes.Repeat([]byte{0x42}, 32)},
+		Suffixes: config.SuffixesConfig{
+			Encrypted: ".encrypted.yaml",
+			Decrypted: ".decrypted.yaml",
+			Plain:     ".plain.yaml",
+		},
+		Root:      t.TempDir(),
+		BindPaths: true,
+	}
+	file, err := actions.NewFile(filepath.Join(c.Root, "secrets.decrypted.yaml"), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file.DecryptedPath, []byte(bindDoc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	if err := actions.Encrypt([]*actions.File{&file}, caches, 4, 1, time.Second, false, false, false); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	return c, file
+}
+
+func runDecrypt(t *testing.T, c config.Config, file actions.File) error {
+	t.Helper()
+	// use a fresh cache, so the provider is the one checking the bindings
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	return actions.Decrypt([]*actions.File{&file}, false, false, false, caches, 4, 1, time.Second, false)
+}
+
+func TestBindPathsRoundTrip(t *testing.T) {
+	c, file := bindRepo(t)
+	os.Remove(file.DecryptedPath)
+	if err := runDecrypt(t, c, file); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	out, err := os.ReadFile(file.DecryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != bindDoc {
+		t.Errorf("decrypted file is incorrect:\n%s", out)
+	}
+}
+
+func TestBindPathsMovedValue(t *testing.T) {
+	c, file := bindRepo(t)
+	values := encryptedValues(t, file.EncryptedPath)
+	password, user := values[`0."db"."password"`], values[`0."db"."user"`]
+	if password == "" || user == "" {
+		t.Fatalf("missing encrypted values: %v", values)
+	}
+	password = base64.StdEncoding.EncodeToString([]byte(password))
+	user = base64.StdEncoding.EncodeToString([]byte(user))
+	// swap the two ciphertexts
+	src, err := os.ReadFile(file.EncryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped := strings.NewReplacer(password, user, user, password).Replace(string(src))
+	if err := os.WriteFile(file.EncryptedPath, []byte(swapped), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = runDecrypt(t, c, file)
+	if err == nil {
+		t.Fatal("expected decrypting swapped values to fail, got nil")
+	}
+	if !strings.Contains(err.Error(), "moved") {
+		t.Errorf("error should mention the value may have been moved, got: %v", err)
+	}
+}
+
+func TestBindPathsMovedFile(t *testing.T) {
+	c, file := bindRepo(t)
+	other, err := actions.NewFile(filepath.Join(c.Root, "other.encrypted.yaml"), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(file.EncryptedPath, other.EncryptedPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := runDecrypt(t, c, other); err == nil {
+		t.Fatal("expected decrypting a renamed file to fail, got nil")
+	}
+}
+
+func TestBindPathsChangedType(t *testing.T) {
+	c, file := bindRepo(t)
+	if err := os.WriteFile(file.DecryptedPath, []byte("port: !secret 5432\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	if err := actions.Encrypt([]*actions.File{&file}, caches, 4, 1, time.Second, false, false, false); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	src, err := os.ReadFile(file.EncryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "!encrypted:int ") {
+		t.Fatalf("expected an int value, got:\n%s", src)
+	}
+	for _, tag := range []string{"!encrypted ", "!encrypted:bool ", "!encrypted:float "} {
+		changed := strings.Replace(string(src), "!encrypted:int ", tag, 1)
+		if err := os.WriteFile(file.EncryptedPath, []byte(changed), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := runDecrypt(t, c, file)
+		if err == nil {
+			t.Fatalf("expected decrypting a value retagged %s to fail, got nil", tag)
+		}
+		if !strings.Contains(err.Error(), "type changed") {
+			t.Errorf("error should mention the value's type may have been changed, got: %v", err)
+		}
+	}
+}
+
+const rulesDoc = `db:
+  password: hunter2
+  user: admin
+  replica:
+    password: hunter3
+api:
+  token: abc
+data:
+  a: one
+  b: two
+`
+
+const rulesDecrypted = `db:
+  password: !secret hunter2
+  user: admin
+  replica:
+    password: !secret hunter3
+api:
+  token: abc
+data: !secret
+  a: one
+  b: two
+`
+
+func TestSecretRules(t *testing.T) {
+	c := config.Config{
+		Provider: crypto.KeyfileProvider{Key: bytes.Repeat([]byte{0x42}, 32)},
+		Suffixes: config.SuffixesConfig{
+			Encrypted: ".encrypted.yaml",
+			Decrypted: ".decrypted.yaml",
+			Plain:     ".plain.yaml",
+		},
+		Root: t.TempDir(),
+		SecretRules: []config.SecretRule{
+			{Paths: []string{"**.password"}},
+			{Files: "apps/**", Paths: []string{"data"}},
+			{Files: "other/*", Paths: []string{"/^api\\./"}},
+		},
+	}
+	if err := os.Mkdir(filepath.Join(c.Root, "apps"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	file, err := actions.NewFile(filepath.Join(c.Root, "apps", "secrets.decrypted.yaml"), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file.DecryptedPath, []byte(rulesDoc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	if err := actions.Encrypt([]*actions.File{&file}, caches, 4, 1, time.Second, false, false, false); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	values := encryptedValues(t, file.EncryptedPath)
+	for _, path := range []string{`0."db"."password"`, `0."db"."replica"."password"`, `0."data"`} {
+		if _, ok := values[path]; !ok {
+			t.Errorf("expected %s to be encrypted, got %v", path, values)
+		}
+	}
+	if len(values) != 3 {
+		t.Errorf("expected 3 encrypted values, got %v", values)
+	}
+	os.Remove(file.DecryptedPath)
+	if err := runDecrypt(t, c, file); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	out, err := os.ReadFile(file.DecryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != rulesDecrypted {
+		t.Errorf("decrypted file is incorrect:\n%s", out)
+	}
+}
+
+func TestProviderRules(t *testing.T) {
+	devKey, prodKey := bytes.Repeat([]byte{0x42}, 32), bytes.Repeat([]byte{0x43}, 32)
+	var devProvider crypto.Provider = crypto.KeyfileProvider{Key: devKey}
+	var prodProvider crypto.Provider = crypto.KeyfileProvider{Key: prodKey}
+	c := config.Config{
+		Provider: devProvider,
+		Suffixes: config.SuffixesConfig{
+			Encrypted: ".encrypted.yaml",
+			Decrypted: ".decrypted.yaml",
+			Plain:     ".plain.yaml",
+		},
+		Root: t.TempDir(),
+		ProviderRules: []config.ProviderRule{
+			{Files: "envs/prod/**", Provider: prodProvider, Name: "prod"},
+		},
+	}
+	var files []*actions.File
+	for _, dir := range []string{"envs/dev", "envs/prod/eu"} {
+		if err := os.MkdirAll(filepath.Join(c.Root, dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+		file, err := actions.NewFile(filepath.Join(c.Root, dir, "secrets.decrypted.yaml"), &c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file.DecryptedPath, []byte(bindDoc), 0600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, &file)
+	}
+	if files[0].ProviderName != "" || files[1].ProviderName != "prod" {
+		t.Fatalf("files got the wrong providers: %q, %q", files[0].ProviderName, files[1].ProviderName)
+	}
+	caches := cache.SetupCaches(c, false)
+	if err := actions.Encrypt(files, caches, 4, 1, time.Second, false, false, false); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if err := caches.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the same plaintexts are in both files, so a shared cache would have reused the dev ciphertexts for prod
+	for i, provider := range []crypto.Provider{devProvider, prodProvider} {
+		for path, value := range encryptedValues(t, files[i].EncryptedPath) {
+			if _, err := crypto.Decrypt(provider, []byte(value), nil, 1, time.Second); err != nil {
+				t.Errorf("%s in %s isn't encrypted with the right key: %v", path, files[i].EncryptedPath, err)
+			}
+			if _, err := crypto.Decrypt(devProvider, []byte(value), nil, 1, time.Second); i == 1 && err == nil {
+				t.Errorf("%s in %s can be decrypted with the dev key", path, files[i].EncryptedPath)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(c.Root, ".yamlcrypt.cache", "providers", "prod")); err != nil {
+		t.Errorf("prod provider should have its own cache: %v", err)
+	}
+}
+
+const jsonDoc = `{
+  "db": {
+    "host": "localhost",
+    "password": {
+      "$secret": "hunter2"
+    },
+    "port": {
+      "$secret": 5432
+    }
+  },
+  "keys": {
+    "$secret": [
+      "a",
+      "b"
+    ]
+  },
+  "enabled": true
+}
+`
+
+func TestJSONRoundTrip(t *testing.T) {
+	c := config.Config{
+		Provider:     crypto.KeyfileProvider{Key: bytes.Repeat([]byte{0x42}, 32)},
+		Suffixes:     config.DefaultSuffixesConfig,
+		JSONSuffixes: config.DefaultJSONSuffixesConfig,
+		Root:         t.TempDir(),
+		BindPaths:    true,
+	}
+	file, err := actions.NewFile(filepath.Join(c.Root, "config.decrypted.json"), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.EncryptedPath != filepath.Join(c.Root, "config.encrypted.json") {
+		t.Fatalf("wrong encrypted path %s", file.EncryptedPath)
+	}
+	if err := os.WriteFile(file.DecryptedPath, []byte(jsonDoc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	if err := actions.Encrypt([]*actions.File{&file}, caches, 4, 1, time.Second, false, false, false); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	encrypted, err := os.ReadFile(file.EncryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(encrypted, &parsed); err != nil {
+		t.Fatalf("encrypted file isn't valid JSON: %v\n%s", err, encrypted)
+	}
+	for _, key := range []string{`"$encrypted"`, `"$encrypted:int"`, `"$encrypted:seq"`} {
+		if !strings.Contains(string(encrypted), key) {
+			t.Errorf("encrypted file should contain %s:\n%s", key, encrypted)
+		}
+	}
+	os.Remove(file.DecryptedPath)
+	if err := runDecrypt(t, c, file); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	out, err := os.ReadFile(file.DecryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != jsonDoc {
+		t.Errorf("decrypted file is incorrect:\n%s", out)
+	}
+	if err := actions.Decrypt([]*actions.File{&file}, true, false, false, caches, 4, 1, time.Second, false); err != nil {
+		t.Fatalf("decrypt --plain: %v", err)
+	}
+	plain, err := os.ReadFile(file.PlainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	json.Unmarshal(plain, &got)
+	json.Unmarshal([]byte(`{"db": {"host": "localhost", "password": "hunter2", "port": 5432}, "keys": ["a", "b"], "enabled": true}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("plain file is incorrect:\n%s", plain)
+	}
+}
+
+const dotenvDoc = `# database
+DB_HOST=localhost
+# !secret
+DB_PASSWORD="hunter2 # not a comment"
+# !secret
+DB_PORT=5432 # the port
+DB_USER='admin'
+
+API_TOKEN=abc
+`
+
+const dotenvDecrypted = `# database
+DB_HOST=localhost
+# !secret
+DB_PASSWORD='hunter2 # not a comment'
+# !secret
+DB_PORT=5432
+DB_USER='admin'
+
+# !secret
+API_TOKEN=abc
+`
+
+func TestDotenvRoundTrip(t *testing.T) {
+	c := config.Config{
+		Provider:       crypto.KeyfileProvider{Key: bytes.Repeat([]byte{0x42}, 32)},
+		Suffixes:       config.DefaultSuffixesConfig,
+		DotenvSuffixes: config.DefaultDotenvSuffixesConfig,
+		Root:           t.TempDir(),
+		SecretRules:    []config.SecretRule{{Paths: []string{"*_TOKEN"}}},
+	}
+	file, err := actions.NewFile(filepath.Join(c.Root, "app.decrypted.env"), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file.DecryptedPath, []byte(dotenvDoc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	if err := actions.Encrypt([]*actions.File{&file}, caches, 4, 1, time.Second, false, false, false); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	encrypted, err := os.ReadFile(file.EncryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []string{"DB_HOST=localhost\n", "DB_PASSWORD=!encrypted:", "DB_PORT=!encrypted:int:", "API_TOKEN=!encrypted:"} {
+		if !strings.Contains(string(encrypted), prefix) {
+			t.Errorf("encrypted file should contain %q:\n%s", prefix, encrypted)
+		}
+	}
+	os.Remove(file.DecryptedPath)
+	if err := runDecrypt(t, c, file); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	out, err := os.ReadFile(file.DecryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != dotenvDecrypted {
+		t.Errorf("decrypted file is incorrect:\n%s", out)
+	}
+	if err := actions.Decrypt([]*actions.File{&file}, true, false, false, caches, 4, 1, time.Second, false); err != nil {
+		t.Fatalf("decrypt --plain: %v", err)
+	}
+	plain, err := os.ReadFile(file.PlainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.ReplaceAll(dotenvDecrypted, "# !secret\n", ""); string(plain) != want {
+		t.Errorf("plain file is incorrect:\n%s", plain)
+	}
+}
+
+const kubernetesDoc = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  host: localhost
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+type: Opaque
+data:
+  password: aHVudGVyMg==
+stringData:
+  user: admin
+`
+
+const kubernetesDecrypted = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  host: localhost
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+type: Opaque
+data:
+  password: !secret:base64 aHVudGVyMg==
+stringData:
+  user: !secret admin
+`
+
+func TestKubernetesSecrets(t *testing.T) {
+	c := config.Config{
+		Provider:          crypto.KeyfileProvider{Key: bytes.Repeat([]byte{0x42}, 32)},
+		Suffixes:          config.DefaultSuffixesConfig,
+		Root:              t.TempDir(),
+		KubernetesSecrets: true,
+	}
+	file, err := actions.NewFile(filepath.Join(c.Root, "secret.decrypted.yaml"), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file.DecryptedPath, []byte(kubernetesDoc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	if err := actions.Encrypt([]*actions.File{&file}, caches, 4, 1, time.Second, false, false, false); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	values := encryptedValues(t, file.EncryptedPath)
+	if len(values) != 2 {
+		t.Fatalf("expected 2 encrypted values, got %v", values)
+	}
+	// data is encrypted as its decoded bytes
+	plaintext, err := crypto.Decrypt(c.Provider, []byte(values[`1."data"."password"`]), nil, 1, time.Second)
+	if err != nil || plaintext != "hunter2" {
+		t.Errorf("data.password should be encrypted as its decoded value, got %q, %v", plaintext, err)
+	}
+	os.Remove(file.DecryptedPath)
+	if err := runDecrypt(t, c, file); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	out, err := os.ReadFile(file.DecryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != kubernetesDecrypted {
+		t.Errorf("decrypted file is incorrect:\n%s", out)
+	}
+	if err := actions.Decrypt([]*actions.File{&file}, true, false, false, caches, 4, 1, time.Second, false); err != nil {
+		t.Fatalf("decrypt --plain: %v", err)
+	}
+	plain, err := os.ReadFile(file.PlainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != kubernetesDoc {
+		t.Errorf("plain file is incorrect:\n%s", plain)
+	}
+}
+
+func TestDecryptNodesMissingFile(t *testing.T) {
+	c, _ := bindRepo(t)
+	path := filepath.Join(c.Root, "missing.encrypted.yaml")
+	file, err := actions.NewStdoutFile(path, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	_, err = actions.DecryptNodes([]*actions.File{&file}, caches, 4, 1, time.Second, false)
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Error for a missing file should name it, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// A secret value that was added, removed, or changed between two versions of a file.
+type SecretChange struct {
+	// The path of the value, starting with the index of its document.
+	Path *yaml.Path
+	Old  string
+	New  string
+	// The tags the value is encrypted with in each version, which record its type.
+	OldTag  string
+	NewTag  string
+	Added   bool
+	Removed bool
+}
+
+// The changes to the secret values in a file between two versions of it. Name is relative to the root of the repo.
+type FileDiff struct {
+	Name    string
+	Changes []SecretChange
+}
+
+// Compare the !secret values in two decrypted versions of a file, either of which may be nil if the file didn't exist. Changes are listed in the order the values appear in the new version, followed by any values that were removed.
+func DiffSecrets(old *yamlv3.Node, new *yamlv3.Node) ([]SecretChange, error) {
+	var oldValues, newValues []yaml.SecretValue
+	var err error
+	if old != nil {
+		if oldValues, err = yaml.GetSecretValues(old, nil); err != nil {
+			return nil, err
+		}
+	}
+	if new != nil {
+		if newValues, err = yaml.GetSecretValues(new, nil); err != nil {
+			return nil, err
+		}
+	}
+	oldByPath := map[string]yaml.SecretValue{}
+	for _, value := range oldValues {
+		oldByPath[value.Path.String()] = value
+	}
+	var out []SecretChange
+	newPaths := map[string]bool{}
+	for _, value := range newValues {
+		path := value.Path.String()
+		newPaths[path] = true
+		// a change of type changes what the value decrypts to, even if its string is the same
+		if oldValue, ok := oldByPath[path]; !ok {
+			out = append(out, SecretChange{Path: value.Path, New: value.Value, NewTag: value.Tag, Added: true})
+		} else if oldValue.Value != value.Value || oldValue.Tag != value.Tag {
+			out = append(out, SecretChange{Path: value.Path, Old: oldValue.Value, New: value.Value, OldTag: oldValue.Tag, NewTag: value.Tag})
+		}
+	}
+	for _, value := range oldValues {
+		if !newPaths[value.Path.String()] {
+			out = append(out, SecretChange{Path: value.Path, Old: value.Value, OldTag: value.Tag, Removed: true})
+		}
+	}
+	return out, nil
+}
+
+// Compare the secret values in the encrypted files under the given paths, relative to the root of the repo, between two revisions in git, either of which may be "" for the working tree. Both versions of every file are decrypted with the current config, and only files with changes are returned.
+func DiffRevisions(c *config.Config, oldRev string, newRev string, paths []string, caches *cache.Caches, threads int, retries uint, timeout time.Duration, progress bool) ([]FileDiff, error) {
+	revs := [2]string{oldRev, newRev}
+	var names []string
+	var listed [2]map[string]bool
+	seen := map[string]bool{}
+	for j, rev := range revs {
+		files, err := encryptedFilesAt(c, rev, paths)
+		if err != nil {
+			return nil, err
+		}
+		listed[j] = map[string]bool{}
+		for _, name := range files {
+			listed[j][name] = true
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	// read in each version of each file, keeping track of where its node is, or -1 if it doesn't exist
+	var files []*File
+	var nodes []yamlv3.Node
+	versions := make([][2]int, len(names))
+	for i, name := range names {
+		for j, rev := range revs {
+			versions[i][j] = -1
+			if !listed[j][name] {
+				continue
+			}
+			contents, err := readAt(c, rev, name)
+			if err != nil {
+				return nil, err
+			}
+			node, err := yaml.Read(bytes.NewReader(contents), name)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading yaml file %s: %w", name, err)
+			}
+			file, err := NewStdoutFile(filepath.Join(c.Root, filepath.FromSlash(name)), c)
+			if err != nil {
+				return nil, err
+			}
+			versions[i][j] = len(nodes)
+			files = append(files, &file)
+			nodes = append(nodes, node)
+		}
+	}
+	if err := DecryptRead(files, nodes, caches, threads, retries, timeout, progress); err != nil {
+		return nil, err
+	}
+	var out []FileDiff
+	for i, name := range names {
+		var versionNodes [2]*yamlv3.Node
+		for j, k := range versions[i] {
+			if k != -1 {
+				versionNodes[j] = &nodes[k]
+			}
+		}
+		changes, err := DiffSecrets(versionNodes[0], versionNodes[1])
+		if err != nil {
+			return nil, fmt.Errorf("Error comparing %s: %w", name, err)
+		}
+		if len(changes) > 0 {
+			out = append(out, FileDiff{Name: name, Changes: changes})
+		}
+	}
+	return out, nil
+}
+
+// Write the changes to secret values in files like a diff, with a line for each value marked +, -, or ~ for added, removed, or changed, noting changes to their types. Values themselves are only written if showValues is set, diffed line by line.
+func WriteDiff(w io.Writer, diffs []FileDiff, oldLabel string, newLabel string, showValues bool) error {
+	var b bytes.Buffer
+	dmp := diffmatchpatch.New()
+	prefixes := map[diffmatchpatch.Operation]string{
+		diffmatchpatch.DiffDelete: "  - ",
+		diffmatchpatch.DiffInsert: "  + ",
+		diffmatchpatch.DiffEqual:  "    ",
+	}
+	for _, diff := range diffs {
+		fmt.Fprintf(&b, "--- a/%s (%s)\n+++ b/%s (%s)\n", diff.Name, oldLabel, diff.Name, newLabel)
+		for _, change := range diff.Changes {
+			marker := "~"
+			if change.Added {
+				marker = "+"
+			} else if change.Removed {
+				marker = "-"
+			}
+			document, path := change.Path.Document()
+			name := path.String()
+			if name == "" {
+				name = "."
+			}
+			if document > 0 {
+				name += fmt.Sprintf(" (document %d)", document)
+			}
+			if !change.Added && !change.Removed && change.OldTag != change.NewTag {
+				name += fmt.Sprintf(" (%s -> %s)", change.OldTag, change.NewTag)
+			}
+			b.WriteString(marker + " " + name + "\n")
+			if !showValues {
+				continue
+			}
+			oldChars, newChars, lines := dmp.DiffLinesToChars(change.Old, change.New)
+			for _, d := range dmp.DiffCharsToLines(dmp.DiffMain(oldChars, newChars, false), lines) {
+				for _, line := range strings.SplitAfter(d.Text, "\n") {
+					if line != "" {
+						b.WriteString(prefixes[d.Type] + strings.TrimSuffix(line, "\n") + "\n")
+					}
+				}
+			}
+		}
+	}
+	_, err := b.WriteTo(w)
+	return err
+}
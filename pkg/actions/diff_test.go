@@ -0,0 +1,45 @@
+package actions_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+func TestDiffSecretsTypes(t *testing.T) {
+	parse := func(s string) *yamlv3.Node {
+		var node yamlv3.Node
+		if err := yamlv3.Unmarshal([]byte(s), &node); err != nil {
+			t.Fatal(err)
+		}
+		return &node
+	}
+	old := parse("a: !secret 5\nb: !secret aGk=\nc: !secret same\n")
+	new := parse("a: !secret \"5\"\nb: !secret:base64 aGk=\nc: !secret same\n")
+	changes, err := actions.DiffSecrets(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []actions.SecretChange{
+		{Old: "5", New: "5", OldTag: "!encrypted:int", NewTag: "!encrypted"},
+		{Old: "aGk=", New: "hi", OldTag: "!encrypted", NewTag: "!encrypted:base64"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d: %v", len(expected), len(changes), changes)
+	}
+	for i, change := range changes {
+		change.Path = nil
+		if change != expected[i] {
+			t.Errorf("Expected change %d to be %v, got %v", i, expected[i], change)
+		}
+	}
+	var out bytes.Buffer
+	if err := actions.WriteDiff(&out, []actions.FileDiff{{Name: "f.yaml", Changes: changes}}, "old", "new", false); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "--- a/f.yaml (old)\n+++ b/f.yaml (new)\n~ \"a\" (!encrypted:int -> !encrypted)\n~ \"b\" (!encrypted -> !encrypted:base64)\n"; out.String() != expected {
+		t.Errorf("Expected diff:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,128 @@
+package actions
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// A decrypted secret value, with the name it's exported under.
+type ExportedValue struct {
+	Name  string
+	Value string
+}
+
+// Flatten the !secret values in decrypted files into named values, in the order they appear. Only values whose paths match any of the patterns are included, or all of them if there aren't any patterns.
+// Each value is named by passing the keys and indices in its path, without the document index, to name. It's an error for two values to get the same name, or for a value to be a whole document.
+func FlattenSecrets(nodes []yamlv3.Node, patterns []*yaml.PathPattern, name func(segments []string) string) ([]ExportedValue, error) {
+	var out []ExportedValue
+	paths := map[string]string{}
+	for i := range nodes {
+		values, err := yaml.GetSecretValues(&nodes[i], patterns)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			path := value.Path.String()
+			segments := value.Path.Segments()[1:]
+			// a whole document has no keys to name it by
+			if len(segments) == 0 {
+				return nil, fmt.Errorf("Value at %s is a whole document, so it can't be named", path)
+			}
+			n := name(segments)
+			if other, ok := paths[n]; ok {
+				return nil, fmt.Errorf("Values at %s and %s would both be named %s", other, path, n)
+			}
+			paths[n] = path
+			out = append(out, ExportedValue{Name: n, Value: value.Value})
+		}
+	}
+	return out, nil
+}
+
+// Schemes for naming flattened values as environment variables, by the name of the scheme.
+var EnvNamingSchemes = map[string]func(segments []string) string{
+	// db.password becomes DB_PASSWORD
+	"upper-snake": func(segments []string) string { return strings.ToUpper(envName(segments)) },
+	// db.password becomes db_password
+	"snake": envName,
+	// db.password becomes password
+	"key": func(segments []string) string { return envName(segments[len(segments)-1:]) },
+}
+
+// Characters that aren't allowed in environment variable names.
+var envInvalidRegex = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// Join the keys and indices in a path with underscores, replacing anything not allowed in an environment variable name with an underscore.
+func envName(segments []string) string {
+	name := envInvalidRegex.ReplaceAllString(strings.Join(segments, "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// The keys allowed in the data of Kubernetes Secrets and ConfigMaps.
+var kubernetesKeyRegex = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// Name a flattened value by joining the keys and indices in its path with dots, like db.password, as a key for a Kubernetes Secret or ConfigMap.
+func KubernetesKey(segments []string) string {
+	return strings.Join(segments, ".")
+}
+
+// Build a Kubernetes manifest of the given kind, Secret or ConfigMap, holding the given values. Secrets hold every value base64-encoded in data; ConfigMaps hold text values in data, and anything else base64-encoded in binaryData.
+func KubernetesManifest(kind string, name string, namespace string, values []ExportedValue) (yamlv3.Node, error) {
+	if kind != "Secret" && kind != "ConfigMap" {
+		return yamlv3.Node{}, fmt.Errorf("Can't export values as a %s", kind)
+	}
+	metadata := mappingNode("name", scalarNode(name))
+	if namespace != "" {
+		metadata.Content = append(metadata.Content, scalarNode("namespace"), scalarNode(namespace))
+	}
+	manifest := mappingNode(
+		"apiVersion", scalarNode("v1"),
+		"kind", scalarNode(kind),
+		"metadata", metadata,
+	)
+	if kind == "Secret" {
+		manifest.Content = append(manifest.Content, scalarNode("type"), scalarNode("Opaque"))
+	}
+	data, binaryData := mappingNode(), mappingNode()
+	for _, value := range values {
+		if !kubernetesKeyRegex.MatchString(value.Name) {
+			return yamlv3.Node{}, fmt.Errorf("%s isn't a valid key for a %s", value.Name, kind)
+		}
+		if kind == "ConfigMap" && utf8.ValidString(value.Value) {
+			data.Content = append(data.Content, scalarNode(value.Name), scalarNode(value.Value))
+		} else if kind == "ConfigMap" {
+			binaryData.Content = append(binaryData.Content, scalarNode(value.Name), scalarNode(base64.StdEncoding.EncodeToString([]byte(value.Value))))
+		} else {
+			data.Content = append(data.Content, scalarNode(value.Name), scalarNode(base64.StdEncoding.EncodeToString([]byte(value.Value))))
+		}
+	}
+	manifest.Content = append(manifest.Content, scalarNode("data"), data)
+	if len(binaryData.Content) > 0 {
+		manifest.Content = append(manifest.Content, scalarNode("binaryData"), binaryData)
+	}
+	return yamlv3.Node{Kind: yamlv3.DocumentNode, Content: []*yamlv3.Node{manifest}}, nil
+}
+
+func scalarNode(value string) *yamlv3.Node {
+	node := &yamlv3.Node{}
+	node.SetString(value)
+	return node
+}
+
+// Make a mapping Node from alternating keys and values.
+func mappingNode(keysAndValues ...interface{}) *yamlv3.Node {
+	node := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		node.Content = append(node.Content, scalarNode(keysAndValues[i].(string)), keysAndValues[i+1].(*yamlv3.Node))
+	}
+	return node
+}
@@ -0,0 +1,26 @@
+package actions_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+func TestFlattenSecretsWholeDocument(t *testing.T) {
+	var node yamlv3.Node
+	if err := yamlv3.Unmarshal([]byte("!secret hunter2\n"), &node); err != nil {
+		t.Fatal(err)
+	}
+	schemes := map[string]func([]string) string{"k8s": actions.KubernetesKey}
+	for name, scheme := range actions.EnvNamingSchemes {
+		schemes[name] = scheme
+	}
+	for name, scheme := range schemes {
+		_, err := actions.FlattenSecrets([]yamlv3.Node{node}, nil, scheme)
+		if err == nil || !strings.Contains(err.Error(), "whole document") {
+			t.Errorf("Flattening a whole document secret with %s naming should fail, got %v", name, err)
+		}
+	}
+}
@@ -2,41 +2,150 @@ package actions
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/crypto"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
 )
 
 type File struct {
 	EncryptedPath string
 	DecryptedPath string
 	PlainPath     string
+	// The name this file's ciphertexts are bound to, or "" if they aren't bound to their paths.
+	Binding string
+	// Patterns of the paths of values that are secrets even if they aren't tagged, from the config's secret rules that apply to this file.
+	SecretPaths []*yaml.PathPattern
+	// Whether every value in the data and stringData of any Kubernetes Secrets in this file is a secret.
+	KubernetesSecrets bool
+	// The provider this file is encrypted with.
+	Provider crypto.Provider
+	// The name of the provider rule this file's provider comes from, or "" if it's the repo's own provider. Files with different providers never share cached ciphertexts.
+	ProviderName string
+	// Where the fingerprint of the encrypted file is recorded when the decrypted file is produced, or "" if the file is outside of the repo.
+	FingerprintPath string
 }
 
 func NewFile(path string, config *config.Config) (File, error) {
-	path, err := barePath(path, config)
-	return File{
-		EncryptedPath: path + config.Suffixes.Encrypted,
-		DecryptedPath: path + config.Suffixes.Decrypted,
-		PlainPath:     path + config.Suffixes.Plain,
-	}, err
+	bare, suffixes, err := barePath(path, config)
+	if err != nil {
+		return File{}, err
+	}
+	file := File{
+		EncryptedPath:     bare + suffixes.Encrypted,
+		DecryptedPath:     bare + suffixes.Decrypted,
+		PlainPath:         bare + suffixes.Plain,
+		KubernetesSecrets: config.KubernetesSecrets,
+	}
+	if err = file.configure(path, config); err != nil {
+		return file, err
+	}
+	if len(config.SecretRules) > 0 {
+		if file.SecretPaths, err = secretPaths(path, config); err != nil {
+			return file, err
+		}
+	}
+	// files outside of the repo just don't get checked for staleness
+	file.FingerprintPath, _ = fingerprintPath(path, config)
+	return file, nil
+}
+
+// Get a File for printing the decrypted contents of an encrypted file, which only needs a suffix if bindPaths is enabled or the config has provider rules.
+func NewStdoutFile(path string, config *config.Config) (File, error) {
+	file := File{EncryptedPath: path}
+	return file, file.configure(path, config)
+}
+
+// Set the binding and provider of a File, from the config.
+func (f *File) configure(path string, config *config.Config) error {
+	f.Provider = config.Provider
+	if !config.BindPaths && len(config.ProviderRules) == 0 {
+		return nil
+	}
+	name, err := Binding(path, config)
+	if err != nil {
+		return err
+	}
+	if config.BindPaths {
+		f.Binding = name
+	}
+	f.ProviderName, f.Provider = config.ProviderFor(name)
+	return nil
+}
+
+// Get the path patterns from all of the config's secret rules that apply to a file.
+func secretPaths(path string, config *config.Config) ([]*yaml.PathPattern, error) {
+	name, err := Binding(path, config)
+	if err != nil {
+		return nil, err
+	}
+	var out []*yaml.PathPattern
+	for i, rule := range config.SecretRules {
+		if !rule.Matches(name) {
+			continue
+		}
+		for _, p := range rule.Paths {
+			pattern, err := yaml.ParsePathPattern(p)
+			if err != nil {
+				return nil, fmt.Errorf("Error in .secretRules[%d]: %w", i, err)
+			}
+			out = append(out, pattern)
+		}
+	}
+	return out, nil
+}
+
+// Get the name that a file's ciphertexts are bound to when bindPaths is enabled: its path relative to the repo root, without any suffix.
+func Binding(path string, config *config.Config) (string, error) {
+	bare, _, err := barePath(path, config)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(bare)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(config.Root, abs)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("File %s is outside of the repo", path)
+	}
+	return strings.TrimSuffix(rel, "."), nil
+}
+
+// Get the additional authenticated data that the value at the given yaml path in this file, encrypted with the given tag, is bound to, or nil if the file's ciphertexts aren't bound to their paths. The tag records the value's type, so it can't be changed either.
+func (f *File) AAD(path string, tag string) []byte {
+	if f.Binding == "" {
+		return nil
+	}
+	return []byte(f.Binding + "\n" + path + "\n" + tag)
 }
 
-func barePath(path string, config *config.Config) (string, error) {
+// Get a path without its suffix, along with the set of suffixes it was found in.
+func barePath(path string, c *config.Config) (string, config.SuffixesConfig, error) {
 	dir := filepath.Dir(path)
 	name := filepath.Base(path)
 	length := -1
-	for _, suffix := range []string{config.Suffixes.Encrypted, config.Suffixes.Decrypted, config.Suffixes.Plain} {
-		if strings.HasSuffix(name, suffix) {
-			length = len(suffix)
+	found := c.Suffixes
+	for _, suffixes := range c.AllSuffixes() {
+		for _, suffix := range []string{suffixes.Encrypted, suffixes.Decrypted, suffixes.Plain} {
+			if config.HasSuffix(name, suffix) {
+				length = len(suffix)
+				found = suffixes
+			}
 		}
 	}
 	if length == -1 {
-		return "", errors.New("Filename does not end with any of the configured suffixes")
+		return "", found, errors.New("Filename does not end with any of the configured suffixes")
 	}
-	return filepath.Join(dir, name[:len(name)-length]), nil
+	return filepath.Join(dir, name[:len(name)-length]), found, nil
 }
 
 func exists(path string) bool {
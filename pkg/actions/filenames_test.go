@@ -17,12 +17,15 @@ func TestFiles(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		if repo.Skip() {
+			continue
+		}
 		config, err := config.LoadConfig(repo.TmpDir)
 		if err != nil {
 			t.Fatalf("Loading repo %s gave error: %s", repo, err.Error())
 		}
 		for _, file := range repo.Files {
-			for _, kind := range []string{"original", "noop", "plain"} {
+			for _, kind := range []string{"original", repo.Provider, "plain"} {
 				err = repo.Checkout(kind)
 				if err != nil {
 					t.Fatal(err)
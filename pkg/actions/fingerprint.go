@@ -0,0 +1,112 @@
+package actions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache/disk"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+)
+
+// Get the path where the fingerprint of a file's encrypted version is recorded, as of when its decrypted version was produced. Fingerprints are kept in the cache dir, named by a hash of the file's name in the repo.
+func fingerprintPath(path string, config *config.Config) (string, error) {
+	name, err := Binding(path, config)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(name))
+	return filepath.Join(config.Root, disk.CacheDirName, "fingerprints", hex.EncodeToString(sum[:])), nil
+}
+
+// Get the fingerprint of a file's contents.
+func fingerprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Record the fingerprint of a File's encrypted file, since its decrypted file is now up to date with it.
+func recordFingerprint(file *File) error {
+	if file.FingerprintPath == "" || !exists(file.EncryptedPath) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(file.EncryptedPath)
+	if err != nil {
+		return fmt.Errorf("Error reading file %s: %w", file.EncryptedPath, err)
+	}
+	return recordFingerprintOf(file, data)
+}
+
+// Record the fingerprint of the given contents of a File's encrypted file, for when they're written somewhere else first, like by a git merge driver.
+func recordFingerprintOf(file *File, encrypted []byte) error {
+	if file.FingerprintPath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file.FingerprintPath), 0o700); err != nil {
+		return fmt.Errorf("Error creating fingerprint dir: %w", err)
+	}
+	if err := ioutil.WriteFile(file.FingerprintPath, []byte(fingerprint(encrypted)), 0o600); err != nil {
+		return fmt.Errorf("Error recording fingerprint of %s: %w", file.EncryptedPath, err)
+	}
+	return nil
+}
+
+// Compare the recorded fingerprint of a File's encrypted file with its current contents. recorded is false if there's no fingerprint to compare with.
+func compareFingerprint(file *File) (recorded bool, same bool, err error) {
+	if file.FingerprintPath == "" || !exists(file.EncryptedPath) {
+		return false, false, nil
+	}
+	data, err := ioutil.ReadFile(file.FingerprintPath)
+	if os.IsNotExist(err) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, fmt.Errorf("Error reading fingerprint of %s: %w", file.EncryptedPath, err)
+	}
+	encrypted, err := ioutil.ReadFile(file.EncryptedPath)
+	if err != nil {
+		return false, false, fmt.Errorf("Error reading file %s: %w", file.EncryptedPath, err)
+	}
+	return true, fingerprint(encrypted) == string(data), nil
+}
+
+// Refuse to encrypt any File whose encrypted file has changed since its decrypted file was produced, since encrypting it would overwrite those changes. Files without a recorded fingerprint are let through, since there's nothing to compare with.
+func checkStale(files []*File) error {
+	for _, file := range files {
+		recorded, same, err := compareFingerprint(file)
+		if err != nil {
+			return err
+		}
+		if recorded && !same {
+			return fmt.Errorf("%s has changed since %s was decrypted, and encrypting it would overwrite those changes. Decrypt it again, or encrypt with --force to overwrite them anyway", file.EncryptedPath, file.DecryptedPath)
+		}
+	}
+	return nil
+}
+
+// Get the targets of the re-encrypted files whose sources' decrypted files are up to date, so their fingerprints can be recorded once the new versions are saved.
+func upToDateTargets(files []Reencrypted) ([]*File, error) {
+	var out []*File
+	for _, file := range files {
+		recorded, same, err := compareFingerprint(file.Source)
+		if err != nil {
+			return nil, err
+		}
+		if recorded && same {
+			out = append(out, file.Target)
+		}
+	}
+	return out, nil
+}
+
+// Record the fingerprints of Files' encrypted files.
+func recordFingerprints(files []*File) error {
+	for _, file := range files {
+		if err := recordFingerprint(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
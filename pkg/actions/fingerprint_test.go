@@ -0,0 +1,96 @@
+package actions_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+)
+
+func encryptFile(t *testing.T, c config.Config, file actions.File, force bool) error {
+	t.Helper()
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	return actions.Encrypt([]*actions.File{&file}, caches, 4, 1, time.Second, false, false, force)
+}
+
+func TestEncryptStale(t *testing.T) {
+	c, file := bindRepo(t)
+	if err := runDecrypt(t, c, file); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	// an up to date decrypted file can be encrypted, any number of times
+	for i := 0; i < 2; i++ {
+		if err := encryptFile(t, c, file, false); err != nil {
+			t.Fatalf("encrypt: %v", err)
+		}
+	}
+	// someone else changes the encrypted file
+	encrypted, err := os.ReadFile(file.EncryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := append(encrypted, []byte("# changed\n")...)
+	if err := os.WriteFile(file.EncryptedPath, changed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = encryptFile(t, c, file, false)
+	if err == nil || !strings.Contains(err.Error(), "has changed since") {
+		t.Fatalf("expected a stale decrypted file to be refused, got %v", err)
+	}
+	if out, _ := os.ReadFile(file.EncryptedPath); string(out) != string(changed) {
+		t.Errorf("refused encrypt changed the encrypted file:\n%s", out)
+	}
+	// decrypting again brings the decrypted file up to date
+	if err := runDecrypt(t, c, file); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if err := encryptFile(t, c, file, false); err != nil {
+		t.Fatalf("encrypt after decrypting again: %v", err)
+	}
+	// or the change can be overwritten on purpose
+	if err := os.WriteFile(file.EncryptedPath, changed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptFile(t, c, file, true); err != nil {
+		t.Fatalf("forced encrypt: %v", err)
+	}
+	if err := encryptFile(t, c, file, false); err != nil {
+		t.Fatalf("encrypt after forced encrypt: %v", err)
+	}
+}
+
+func TestEncryptUnknownFingerprint(t *testing.T) {
+	c, file := bindRepo(t)
+	// files whose decrypted versions weren't produced by decrypt have nothing to compare with
+	if err := os.RemoveAll(file.FingerprintPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptFile(t, c, file, false); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+}
+
+func TestRekeyKeepsFingerprint(t *testing.T) {
+	c, file := bindRepo(t)
+	if err := runDecrypt(t, c, file); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	files := []*actions.File{&file}
+	reencrypted, err := actions.Reencrypt(files, files, caches, caches, 4, 1, time.Second, false)
+	if err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if err = actions.SaveReencrypted(reencrypted); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := encryptFile(t, c, file, false); err != nil {
+		t.Fatalf("encrypt after rekey: %v", err)
+	}
+}
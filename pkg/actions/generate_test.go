@@ -9,8 +9,9 @@ import (
 	"time"
 
 	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
 	"github.com/farmersedgeinc/yaml-crypt/pkg/cache/disk"
-	"github.com/farmersedgeinc/yaml-crypt/pkg/cache/memory"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
 	"github.com/farmersedgeinc/yaml-crypt/pkg/crypto"
 	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
 )
@@ -38,13 +39,10 @@ func writeRepo(t *testing.T) (dir string, file actions.File) {
 
 func runEncrypt(t *testing.T, file actions.File, noCache bool) error {
 	t.Helper()
-	var provider crypto.Provider = crypto.NoopProvider{}
-	c, err := memory.Setup()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer c.Close()
-	return actions.Encrypt([]*actions.File{&file}, c, &provider, 4, 1, time.Second, false, noCache)
+	file.Provider = crypto.NoopProvider{}
+	caches := cache.SetupCaches(config.Config{}, true)
+	defer caches.Close()
+	return actions.Encrypt([]*actions.File{&file}, caches, 4, 1, time.Second, false, noCache, false)
 }
 
 // encryptedValues returns path->value for all !encrypted nodes. With the noop
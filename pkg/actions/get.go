@@ -0,0 +1,47 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Get the value at a path in one of the documents of an encrypted file, decrypting only the ciphertexts in the way or within it. Decrypted values are tagged !secret, like they are by DecryptNodes.
+func GetNode(file *File, document int, path *yaml.Path, cache cache.Cache, retries uint, timeout time.Duration) (*yamlv3.Node, error) {
+	node, err := yaml.ReadFile(file.EncryptedPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading yaml file %s: %w", file.EncryptedPath, err)
+	}
+	decrypt := func(node *yamlv3.Node, path *yaml.Path) error {
+		ciphertext, err := yaml.GetValue(node)
+		if err != nil {
+			return fmt.Errorf("Error getting encrypted value at %s: %w", path.String(), err)
+		}
+		aad := file.AAD(path.String(), node.Tag)
+		if _, err := DecryptCiphertext([]byte(ciphertext), aad, cache, &file.Provider, retries, timeout); err != nil {
+			return err
+		}
+		if err := yaml.DecryptNode(node, aad, cache); err != nil {
+			return fmt.Errorf("Error decrypting node %s using cache: %w", path.String(), err)
+		}
+		return nil
+	}
+	found, foundPath, err := yaml.FindNode(&node, document, path, decrypt)
+	if err != nil {
+		return nil, err
+	}
+	// decrypt whatever is within the value, which is every ciphertext at or below its path
+	prefix := foundPath.String()
+	for child := range yaml.GetTaggedChildren(&node, yaml.EncryptedTag) {
+		if p := child.Path.String(); p == prefix || strings.HasPrefix(p, prefix+".") {
+			if err := decrypt(child.YamlNode, child.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return found, nil
+}
@@ -2,19 +2,44 @@ package actions
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/farmersedgeinc/yaml-crypt/pkg/cache/disk"
 	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/crypto"
 )
 
 func UpdateGitignore(c *config.Config) error {
 	path := filepath.Join(c.Root, ".gitignore")
-	ignores := c.Suffixes.GitignoreSet()
+	ignores := map[string]bool{}
+	for _, suffixes := range c.AllSuffixes() {
+		for ignore := range suffixes.GitignoreSet() {
+			ignores[ignore] = true
+		}
+	}
 	ignores["/"+disk.CacheDirName] = true
+	// a key file inside the repo must never be committed, whichever provider it's for
+	keyPaths := keyfilePaths(c.Provider)
+	for _, rule := range c.ProviderRules {
+		keyPaths = append(keyPaths, keyfilePaths(rule.Provider)...)
+	}
+	for _, keyPath := range keyPaths {
+		if rel, err := filepath.Rel(c.Root, keyPath); err == nil && !strings.HasPrefix(rel, "..") {
+			ignores["/"+filepath.ToSlash(rel)] = true
+		}
+	}
+	return addLines(path, ignores)
+}
+
+// Add any of the given lines that aren't already in a file to the end of it, in order, creating it if it doesn't exist.
+func addLines(path string, lines map[string]bool) error {
 	if exists(path) {
 		existingFile, err := os.Open(path)
 		defer existingFile.Close()
@@ -30,8 +55,8 @@ func UpdateGitignore(c *config.Config) error {
 		scanner := bufio.NewScanner(existingFile)
 		for scanner.Scan() {
 			line := strings.Trim(scanner.Text(), "\r\n")
-			if _, ok := ignores[line]; ok {
-				delete(ignores, line)
+			if _, ok := lines[line]; ok {
+				delete(lines, line)
 			}
 			_, err = fmt.Fprintln(newFile, line)
 			if err != nil {
@@ -41,8 +66,8 @@ func UpdateGitignore(c *config.Config) error {
 		if err = scanner.Err(); err != nil {
 			return err
 		}
-		for ignore := range ignores {
-			_, err = fmt.Fprintln(newFile, ignore)
+		for _, line := range sortedKeys(lines) {
+			_, err = fmt.Fprintln(newFile, line)
 			if err != nil {
 				return err
 			}
@@ -62,8 +87,8 @@ func UpdateGitignore(c *config.Config) error {
 		if err != nil {
 			return err
 		}
-		for ignore := range ignores {
-			_, err := fmt.Fprintln(newFile, ignore)
+		for _, line := range sortedKeys(lines) {
+			_, err := fmt.Fprintln(newFile, line)
 			if err != nil {
 				return err
 			}
@@ -72,3 +97,151 @@ func UpdateGitignore(c *config.Config) error {
 		return err
 	}
 }
+
+func sortedKeys(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for key := range set {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// The name of the git drivers for encrypted files, in .gitattributes and the git config.
+const GitDriverName = "yaml-crypt"
+
+// Set up git to show encrypted files decrypted in diffs, and to merge them value by value, by adding them to the .gitattributes file, and configuring the drivers in the repo's local git config to run command, the path to yaml-crypt.
+func InstallGitDrivers(c *config.Config, command string) error {
+	attributes := map[string]bool{}
+	for _, suffixes := range c.AllSuffixes() {
+		attributes["*."+suffixes.Encrypted+" diff="+GitDriverName] = true
+		attributes["*."+suffixes.Encrypted+" merge="+GitDriverName] = true
+	}
+	if err := addLines(filepath.Join(c.Root, ".gitattributes"), attributes); err != nil {
+		return err
+	}
+	for _, setting := range [][2]string{
+		{"diff." + GitDriverName + ".textconv", command + " textconv"},
+		{"merge." + GitDriverName + ".name", "yaml-crypt merge driver for encrypted files"},
+		{"merge." + GitDriverName + ".driver", command + " merge-driver %O %A %B %P"},
+	} {
+		if _, err := git(c, "config", "--local", setting[0], setting[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the Files an encrypted file given to textconv could be. Git gives textconv a temporary copy of older versions of a file, outside of the repo, so if the file's path matters, because bindPaths is enabled or the config has provider rules, it could be any of the encrypted files in the repo with the same name.
+func TextconvFiles(path string, c *config.Config) ([]*File, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(c.Root, abs)
+	if err != nil {
+		return nil, err
+	}
+	if (!c.BindPaths && len(c.ProviderRules) == 0) || !strings.HasPrefix(rel, "..") {
+		file, err := NewStdoutFile(path, c)
+		return []*File{&file}, err
+	}
+	candidates, err := c.AllEncryptedFiles(c.Root)
+	if err != nil {
+		return nil, err
+	}
+	var out []*File
+	for _, candidate := range candidates {
+		if filepath.Base(candidate) != filepath.Base(path) {
+			continue
+		}
+		file, err := NewStdoutFile(candidate, c)
+		if err != nil {
+			return nil, err
+		}
+		file.EncryptedPath = path
+		out = append(out, &file)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("No encrypted file in the repo is named %s", filepath.Base(path))
+	}
+	return out, nil
+}
+
+// Get the paths of any key files used by a provider.
+func keyfilePaths(provider crypto.Provider) []string {
+	switch p := provider.(type) {
+	case crypto.KeyfileProvider:
+		if p.Path != "" {
+			return []string{p.Path}
+		}
+	case crypto.EnvelopeProvider:
+		var out []string
+		for _, inner := range p.Providers {
+			out = append(out, keyfilePaths(inner)...)
+		}
+		return out
+	}
+	return nil
+}
+
+// Run git in the root of the repo, and return what it prints.
+func git(c *config.Config, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = c.Root
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Error running git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Whether a string names a commit in git, like HEAD or main~2.
+func IsRevision(c *config.Config, rev string) bool {
+	_, err := git(c, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	return err == nil
+}
+
+// List the encrypted files under the given paths, or the whole repo if there aren't any, relative to the root of the repo. Files are listed from a revision in git, or from the working tree if rev is "".
+func encryptedFilesAt(c *config.Config, rev string, paths []string) ([]string, error) {
+	var out []string
+	if rev == "" {
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+		for _, path := range paths {
+			files, err := c.AllEncryptedFiles(filepath.Join(c.Root, path))
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				rel, err := filepath.Rel(c.Root, file)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, filepath.ToSlash(rel))
+			}
+		}
+		return out, nil
+	}
+	listed, err := git(c, append([]string{"ls-tree", "-r", "-z", "--name-only", rev, "--"}, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(string(listed), "\x00") {
+		if name != "" && c.IsEncryptedFile(name) {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+// Read a file, relative to the root of the repo, from a revision in git, or from the working tree if rev is "".
+func readAt(c *config.Config, rev string, name string) ([]byte, error) {
+	if rev == "" {
+		return ioutil.ReadFile(filepath.Join(c.Root, filepath.FromSlash(name)))
+	}
+	return git(c, "show", rev+":./"+name)
+}
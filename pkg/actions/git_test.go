@@ -0,0 +1,108 @@
+package actions_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/actions"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/crypto"
+)
+
+func TestUpdateGitignore(t *testing.T) {
+	root := t.TempDir()
+	c := config.Config{
+		Provider: crypto.KeyfileProvider{Path: filepath.Join(root, ".yamlcrypt.key")},
+		Suffixes: config.SuffixesConfig{
+			Encrypted: ".encrypted.yaml",
+			Decrypted: ".decrypted.yaml",
+			Plain:     ".plain.yaml",
+		},
+		Root: root,
+		ProviderRules: []config.ProviderRule{
+			{Files: "prod/**", Provider: crypto.KeyfileProvider{Path: filepath.Join(root, "keys", "prod.key")}, Name: "prod"},
+			{Files: "outside/**", Provider: crypto.KeyfileProvider{Path: filepath.Join(filepath.Dir(root), "outside.key")}, Name: "outside"},
+		},
+	}
+	if err := actions.UpdateGitignore(&c); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(filepath.Join(root, ".gitignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	ignored := map[string]bool{}
+	for _, line := range lines {
+		ignored[line] = true
+	}
+	for _, expected := range []string{"/.yamlcrypt.key", "/keys/prod.key"} {
+		if !ignored[expected] {
+			t.Errorf("Expected .gitignore to have %s:\n%s", expected, contents)
+		}
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "outside.key") {
+			t.Errorf("Key file outside of the repo shouldn't be in .gitignore:\n%s", contents)
+		}
+	}
+}
+
+func TestTextconvFiles(t *testing.T) {
+	c, file := bindRepo(t)
+	// another file with the same name, bound to a different path
+	if err := os.MkdirAll(filepath.Join(c.Root, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	other, err := actions.NewFile(filepath.Join(c.Root, "other", "secrets.decrypted.yaml"), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(other.DecryptedPath, []byte(bindDoc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	caches := cache.SetupCaches(c, true)
+	defer caches.Close()
+	if err := actions.Encrypt([]*actions.File{&other}, caches, 4, 1, time.Second, false, false, false); err != nil {
+		t.Fatal(err)
+	}
+	// git gives textconv a copy of older versions outside of the repo
+	contents, err := os.ReadFile(file.EncryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(t.TempDir(), "secrets.encrypted.yaml")
+	if err := os.WriteFile(copied, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+	files, err := actions.TextconvFiles(copied, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected both files named secrets.encrypted.yaml to be candidates, got %d", len(files))
+	}
+	decrypted := 0
+	for _, candidate := range files {
+		if candidate.EncryptedPath != copied {
+			t.Errorf("Candidate should be read from the copy, not %s", candidate.EncryptedPath)
+		}
+		// use a fresh cache, so the provider is the one checking the bindings
+		caches := cache.SetupCaches(c, true)
+		_, err := actions.DecryptNodes([]*actions.File{candidate}, caches, 4, 1, time.Second, false)
+		caches.Close()
+		if err == nil {
+			decrypted++
+			if candidate.Binding != "secrets" {
+				t.Errorf("Only the original file's binding should decrypt the copy, but %s did", candidate.Binding)
+			}
+		}
+	}
+	if decrypted != 1 {
+		t.Errorf("Expected exactly one candidate to decrypt, got %d", decrypted)
+	}
+}
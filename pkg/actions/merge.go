@@ -0,0 +1,149 @@
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Merge two versions of an encrypted file with a common ancestor, like a git merge driver: base, ours, and theirs are the paths of temporary copies of each version, and the result is written to ours. path is where the file is in the repo, which determines its format, provider, and binding; if it's "", the file is treated as yaml, and can't be bound or use a provider rule.
+// The versions are decrypted and merged value by value. Ciphertexts are reused for every value whose plaintext didn't change. If there are conflicts, ours' values are kept for them, and if path is given, the decrypted file is written with conflict markers around them, and recorded as up to date with the result. The paths of any conflicts are returned.
+func MergeFiles(c *config.Config, base string, ours string, theirs string, path string, caches *cache.Caches, threads int, retries uint, timeout time.Duration) ([]*yaml.Path, error) {
+	formatPath := path
+	if formatPath == "" {
+		formatPath = ours
+	}
+	file, err := NewStdoutFile(formatPath, c)
+	if err != nil {
+		return nil, err
+	}
+	// read in each version, and the ciphertexts in ours and theirs, so they can be reused
+	var nodes [3]*yamlv3.Node
+	var present [3]bool
+	var ciphertexts [3]map[string]string
+	var files []*File
+	var read []yamlv3.Node
+	for i, versionPath := range []string{base, ours, theirs} {
+		contents, err := ioutil.ReadFile(versionPath)
+		if err != nil {
+			return nil, err
+		}
+		// the base is empty if the file was added on both sides
+		if len(bytes.TrimSpace(contents)) == 0 {
+			continue
+		}
+		node, err := yaml.Read(bytes.NewReader(contents), formatPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading yaml file %s: %w", versionPath, err)
+		}
+		if ciphertexts[i], err = yaml.GetTaggedChildrenValues(&node, yaml.EncryptedTag); err != nil {
+			return nil, fmt.Errorf("Error getting encrypted values from file %s: %w", versionPath, err)
+		}
+		present[i] = true
+		files = append(files, &file)
+		read = append(read, node)
+	}
+	if err := DecryptRead(files, read, caches, threads, retries, timeout, false); err != nil {
+		return nil, err
+	}
+	for i, j := 0, 0; i < len(nodes); i++ {
+		if present[i] {
+			nodes[i] = &read[j]
+			j++
+		}
+	}
+	merged, conflicts := yaml.Merge(nodes[0], nodes[1], nodes[2], false)
+	if merged == nil {
+		// both sides emptied the file
+		return nil, ioutil.WriteFile(ours, nil, 0644)
+	}
+	var decrypted File
+	if len(conflicts) > 0 && path != "" {
+		if decrypted, err = NewFile(path, c); err != nil {
+			return nil, err
+		}
+		theirsMerged, _ := yaml.Merge(nodes[0], nodes[1], nodes[2], true)
+		var ourText, theirText bytes.Buffer
+		if err := yaml.Write(&ourText, decrypted.DecryptedPath, *merged); err != nil {
+			return nil, err
+		}
+		if err := yaml.Write(&theirText, decrypted.DecryptedPath, *theirsMerged); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(decrypted.DecryptedPath, []byte(conflictMarkers(ourText.String(), theirText.String())), 0600); err != nil {
+			return nil, err
+		}
+	}
+	// encrypt the result, reusing ours' or theirs' ciphertext for each value if its plaintext is the same
+	cache, err := caches.Get(file.ProviderName)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := yaml.DeepCopyNode(merged)
+	plaintextSet := map[item]nothing{}
+	if err := addTaggedValuesToSet(&plaintextSet, encrypted, yaml.DecryptedTag, &file); err != nil {
+		return nil, err
+	}
+	if err := encryptPlaintexts(&plaintextSet, cache, &file.Provider, threads, retries, timeout, false); err != nil {
+		return nil, fmt.Errorf("Error encrypting plaintexts: %w", err)
+	}
+	for node := range yaml.GetTaggedChildren(encrypted, yaml.DecryptedTag) {
+		path := node.Path.String()
+		aad := file.AAD(path, yaml.EncryptedTagOf(node.YamlNode))
+		plaintext, err := yaml.GetValue(node.YamlNode)
+		if err != nil {
+			return nil, err
+		}
+		possibleCiphertext := ciphertexts[1][path]
+		if existing, ok, _ := cache.Decrypt([]byte(possibleCiphertext), aad); !ok || existing != plaintext {
+			possibleCiphertext = ciphertexts[2][path]
+		}
+		if err := yaml.EncryptNode(node.YamlNode, aad, []byte(possibleCiphertext), cache); err != nil {
+			return nil, fmt.Errorf("Error encrypting node %s using cache: %w", path, err)
+		}
+	}
+	var out bytes.Buffer
+	if err := yaml.Write(&out, formatPath, *encrypted); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(ours, out.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	// git moves the result into place at path, and the decrypted file with conflict markers is based on it
+	return conflicts, recordFingerprintOf(&decrypted, out.Bytes())
+}
+
+// Combine two versions of a file, marking the lines where they differ like git marks conflicts.
+func conflictMarkers(ours string, theirs string) string {
+	dmp := diffmatchpatch.New()
+	oursChars, theirsChars, lines := dmp.DiffLinesToChars(ours, theirs)
+	var b, ourLines, theirLines strings.Builder
+	flush := func() {
+		if ourLines.Len() > 0 || theirLines.Len() > 0 {
+			b.WriteString("<<<<<<< ours\n" + ourLines.String() + "=======\n" + theirLines.String() + ">>>>>>> theirs\n")
+			ourLines.Reset()
+			theirLines.Reset()
+		}
+	}
+	for _, d := range dmp.DiffCharsToLines(dmp.DiffMain(oursChars, theirsChars, false), lines) {
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			flush()
+			b.WriteString(d.Text)
+		case diffmatchpatch.DiffDelete:
+			ourLines.WriteString(d.Text)
+		case diffmatchpatch.DiffInsert:
+			theirLines.WriteString(d.Text)
+		}
+	}
+	flush()
+	return b.String()
+}
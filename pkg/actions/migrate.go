@@ -0,0 +1,33 @@
+package actions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Save re-encrypted files, then replace the config file at configPath with newConfig.
+// The config file is replaced last, and if any replacement fails, everything is rolled back, so the repo is never left with ciphertexts that its config can't decrypt.
+func SaveMigrated(files []Reencrypted, configPath string, newConfig []byte) error {
+	upToDate, err := upToDateTargets(files)
+	if err != nil {
+		return err
+	}
+	tmpPaths, dests, err := stageReencrypted(files)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(configPath); err == nil {
+		mode = info.Mode()
+	}
+	tmpConfig := configPath + ".tmp"
+	if err = ioutil.WriteFile(tmpConfig, newConfig, mode); err != nil {
+		removeFiles(tmpPaths)
+		return fmt.Errorf("Error writing config file %s: %w", tmpConfig, err)
+	}
+	if err = replaceFiles(append(tmpPaths, tmpConfig), append(dests, configPath)); err != nil {
+		return err
+	}
+	return recordFingerprints(upToDate)
+}
@@ -0,0 +1,198 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/crypto"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// The re-encrypted contents of an encrypted file, ready to be saved to the target's encrypted path.
+type Reencrypted struct {
+	Source *File
+	Target *File
+	Node   yamlv3.Node
+	// The number of encrypted values in the file.
+	Values int
+}
+
+// Count the encrypted values in each of the given files, without decrypting anything.
+func CountEncrypted(files []*File) ([]int, error) {
+	counts := make([]int, len(files))
+	for i, file := range files {
+		node, err := yaml.ReadFile(file.EncryptedPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading yaml file %s: %w", file.EncryptedPath, err)
+		}
+		for range yaml.GetTaggedChildren(&node, yaml.EncryptedTag) {
+			counts[i]++
+		}
+	}
+	return counts, nil
+}
+
+// Decrypt every encrypted value in the sources with their providers, then encrypt them again with the corresponding targets' providers, bound to the targets if they have bindings.
+// Unlike Encrypt, existing ciphertexts are never reused: every value gets a fresh ciphertext. decryptCaches are used to look up the existing plaintexts, and the new ciphertexts are added to encryptCaches.
+// Nothing is written: the results can be saved with SaveReencrypted.
+func Reencrypt(sources []*File, targets []*File, decryptCaches *cache.Caches, encryptCaches *cache.Caches, threads int, retries uint, timeout time.Duration, progress bool) ([]Reencrypted, error) {
+	if len(sources) != len(targets) {
+		return nil, fmt.Errorf("Got %d source files but %d target files", len(sources), len(targets))
+	}
+	// read in files
+	out := make([]Reencrypted, len(sources))
+	for i, file := range sources {
+		node, err := yaml.ReadFile(file.EncryptedPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading yaml file %s: %w", file.EncryptedPath, err)
+		}
+		out[i] = Reencrypted{Source: file, Target: targets[i], Node: node}
+	}
+	// decrypt the nodes in memory, with each source provider
+	for _, group := range groupByProvider(sources) {
+		provider, providerName := sources[group[0]].Provider, sources[group[0]].ProviderName
+		decryptCache, err := decryptCaches.Get(providerName)
+		if err != nil {
+			return nil, err
+		}
+		ciphertextSet := map[item]nothing{}
+		for _, i := range group {
+			if err := addTaggedValuesToSet(&ciphertextSet, &out[i].Node, yaml.EncryptedTag, sources[i]); err != nil {
+				return nil, fmt.Errorf("Error getting encrypted values from file %s: %w", sources[i].EncryptedPath, err)
+			}
+		}
+		if err := decryptCiphertexts(&ciphertextSet, decryptCache, &provider, threads, retries, timeout, progress); err != nil {
+			return nil, fmt.Errorf("Error decrypting existing ciphertexts: %w", err)
+		}
+		for _, i := range group {
+			file := sources[i]
+			for node := range yaml.GetTaggedChildren(&out[i].Node, yaml.EncryptedTag) {
+				if err := yaml.DecryptNode(node.YamlNode, file.AAD(node.Path.String(), node.YamlNode.Tag), decryptCache); err != nil {
+					return nil, fmt.Errorf("Error decrypting node %s using cache: %w", node.Path.String(), err)
+				}
+				out[i].Values++
+			}
+		}
+	}
+	// encrypt every plaintext with each target provider, bypassing the cache
+	for _, group := range groupByProvider(targets) {
+		provider, providerName := targets[group[0]].Provider, targets[group[0]].ProviderName
+		encryptCache, err := encryptCaches.Get(providerName)
+		if err != nil {
+			return nil, err
+		}
+		plaintextSet := map[item]nothing{}
+		for _, i := range group {
+			if err := addTaggedValuesToSet(&plaintextSet, &out[i].Node, yaml.DecryptedTag, targets[i]); err != nil {
+				return nil, fmt.Errorf("Error getting decrypted values from file %s: %w", sources[i].EncryptedPath, err)
+			}
+		}
+		var mutex sync.Mutex
+		err = parallelEach(setItems(&plaintextSet), func(plaintext item) error {
+			aad := []byte(plaintext.aad)
+			ciphertext, err := crypto.Encrypt(provider, plaintext.value, aad, retries, timeout)
+			if err != nil {
+				return fmt.Errorf("Error using provider to encrypt plaintext: %w", err)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err = encryptCache.Add(plaintext.value, aad, ciphertext); err != nil {
+				return fmt.Errorf("Error adding encrypted plaintext to cache: %w", err)
+			}
+			return nil
+		}, threads, progress)
+		if err != nil {
+			return nil, fmt.Errorf("Error encrypting plaintexts: %w", err)
+		}
+		for _, i := range group {
+			for node := range yaml.GetTaggedChildren(&out[i].Node, yaml.DecryptedTag) {
+				path := node.Path.String()
+				if err := yaml.EncryptNode(node.YamlNode, targets[i].AAD(path, yaml.EncryptedTagOf(node.YamlNode)), nil, encryptCache); err != nil {
+					return nil, fmt.Errorf("Error encrypting node %s using cache: %w", path, err)
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// Save re-encrypted files to their targets' encrypted paths. Every file is written to a temporary file first, and they're only moved into place once all of them have been written.
+func SaveReencrypted(files []Reencrypted) error {
+	upToDate, err := upToDateTargets(files)
+	if err != nil {
+		return err
+	}
+	tmpPaths, dests, err := stageReencrypted(files)
+	if err != nil {
+		return err
+	}
+	if err = replaceFiles(tmpPaths, dests); err != nil {
+		return err
+	}
+	// re-encrypting doesn't change any values, so decrypted files that were up to date still are
+	return recordFingerprints(upToDate)
+}
+
+// Write re-encrypted files to temporary files next to their targets' encrypted paths.
+func stageReencrypted(files []Reencrypted) (tmpPaths []string, dests []string, err error) {
+	for _, file := range files {
+		dest := file.Target.EncryptedPath
+		tmpPath := dest + ".tmp"
+		tmpPaths = append(tmpPaths, tmpPath)
+		dests = append(dests, dest)
+		err = yaml.SaveFile(tmpPath, file.Node)
+		// keep the permissions of the file being replaced
+		if info, statErr := os.Stat(dest); err == nil && statErr == nil {
+			err = os.Chmod(tmpPath, info.Mode())
+		}
+		if err != nil {
+			removeFiles(tmpPaths)
+			return nil, nil, fmt.Errorf("Error writing yaml file %s: %w", tmpPath, err)
+		}
+	}
+	return
+}
+
+// Replace each file in dests with the corresponding file in tmpPaths, in order. The replaced files are kept as backups until all of them have been replaced, so if any replacement fails, the ones already made are rolled back.
+func replaceFiles(tmpPaths []string, dests []string) error {
+	backups := make([]string, 0, len(dests))
+	rollback := func() {
+		for i := len(backups) - 1; i >= 0; i-- {
+			if backups[i] != "" {
+				os.Rename(backups[i], dests[i])
+			} else {
+				os.Remove(dests[i])
+			}
+		}
+		removeFiles(tmpPaths)
+	}
+	for i, dest := range dests {
+		backup := ""
+		if exists(dest) {
+			backup = dest + ".bak"
+			if err := os.Rename(dest, backup); err != nil {
+				rollback()
+				return fmt.Errorf("Error backing up %s: %w", dest, err)
+			}
+		}
+		backups = append(backups, backup)
+		if err := os.Rename(tmpPaths[i], dest); err != nil {
+			rollback()
+			return fmt.Errorf("Error replacing %s: %w", dest, err)
+		}
+	}
+	removeFiles(backups)
+	return nil
+}
+
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		if path != "" {
+			os.Remove(path)
+		}
+	}
+}
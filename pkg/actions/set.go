@@ -0,0 +1,82 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
+	"github.com/farmersedgeinc/yaml-crypt/pkg/yaml"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Encrypt a value and set it at a path in one of the documents of an encrypted file, creating any mappings in the way, without decrypting anything. Everything else in the file is left exactly as it was, byte for byte.
+func SetValue(file *File, document int, path *yaml.Path, plaintext string, cache cache.Cache, retries uint, timeout time.Duration) error {
+	info, err := os.Stat(file.EncryptedPath)
+	if err != nil {
+		return err
+	}
+	original, err := ioutil.ReadFile(file.EncryptedPath)
+	if err != nil {
+		return err
+	}
+	node, err := yaml.Read(bytes.NewReader(original), file.EncryptedPath)
+	if err != nil {
+		return fmt.Errorf("Error reading yaml file %s: %w", file.EncryptedPath, err)
+	}
+	var before, after bytes.Buffer
+	if err := yaml.Write(&before, file.EncryptedPath, node); err != nil {
+		return err
+	}
+	_, err = yaml.SetNode(&node, document, path, func(path *yaml.Path) (*yamlv3.Node, error) {
+		ciphertext, err := EncryptPlaintext(plaintext, file.AAD(path.String(), yaml.EncryptedTag), cache, &file.Provider, retries, timeout)
+		if err != nil {
+			return nil, err
+		}
+		value := &yamlv3.Node{}
+		value.Encode(base64.StdEncoding.EncodeToString(ciphertext))
+		value.Tag = yaml.EncryptedTag
+		return value, nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := yaml.Write(&after, file.EncryptedPath, node); err != nil {
+		return err
+	}
+	updated, err := splice(original, before.String(), after.String())
+	if err != nil {
+		return fmt.Errorf("Error updating %s: %w", file.EncryptedPath, err)
+	}
+	// make sure the spliced file means exactly what the updated Node does
+	check, err := yaml.Read(bytes.NewReader(updated), file.EncryptedPath)
+	var rendered bytes.Buffer
+	if err == nil {
+		err = yaml.Write(&rendered, file.EncryptedPath, check)
+	}
+	if err != nil || rendered.String() != after.String() {
+		return fmt.Errorf("Error updating %s: couldn't set the value without reformatting the rest of the file", file.EncryptedPath)
+	}
+	return ioutil.WriteFile(file.EncryptedPath, updated, info.Mode())
+}
+
+// Apply the changes between two renderings of a file to its original bytes, so anything the changes don't touch keeps its original formatting.
+func splice(original []byte, before string, after string) ([]byte, error) {
+	if string(original) == before {
+		return []byte(after), nil
+	}
+	// the patch may apply somewhere slightly off, so SetValue checks the result
+	dmp := diffmatchpatch.New()
+	out, applied := dmp.PatchApply(dmp.PatchMake(before, after), string(original))
+	for _, ok := range applied {
+		if !ok {
+			return nil, errors.New("couldn't find where the value goes in the original file")
+		}
+	}
+	return []byte(out), nil
+}
@@ -1,16 +1,21 @@
 package cache
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+
 	"github.com/farmersedgeinc/yaml-crypt/pkg/cache/disk"
 	"github.com/farmersedgeinc/yaml-crypt/pkg/cache/memory"
 	"github.com/farmersedgeinc/yaml-crypt/pkg/config"
 )
 
+// A cache of (plaintext, ciphertext) pairs. Pairs bound to additional authenticated data (AAD) are only found when looked up with the same AAD; an empty AAD means the pair isn't bound to anything.
 type Cache interface {
 	Close() error
-	Encrypt(plaintext string, potentialCiphertext []byte) ([]byte, bool, error)
-	Decrypt(ciphertext []byte) (string, bool, error)
-	Add(plaintext string, ciphertext []byte) error
+	Encrypt(plaintext string, aad []byte, potentialCiphertext []byte) ([]byte, bool, error)
+	Decrypt(ciphertext []byte, aad []byte) (string, bool, error)
+	Add(plaintext string, aad []byte, ciphertext []byte) error
 }
 
 func Setup(config config.Config, mem bool) (Cache, error) {
@@ -20,3 +25,58 @@ func Setup(config config.Config, mem bool) (Cache, error) {
 		return disk.Setup(config)
 	}
 }
+
+// The caches for each of the providers in a repo, opened as they're needed. Ciphertexts cached for one provider must never be reused for files encrypted with another, so each gets its own cache.
+type Caches struct {
+	config config.Config
+	mem    bool
+	caches map[string]Cache
+}
+
+func SetupCaches(config config.Config, mem bool) *Caches {
+	return &Caches{config: config, mem: mem, caches: map[string]Cache{}}
+}
+
+// Delete the disk caches of every provider in a repo. Anything else kept in the cache dir, like the fingerprints of encrypted files, is left alone.
+func Remove(config config.Config) error {
+	dir := filepath.Join(config.Root, disk.CacheDirName)
+	if err := disk.RemoveDir(dir); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "providers")); err != nil {
+		return fmt.Errorf("Error deleting cache: %w", err)
+	}
+	return nil
+}
+
+// Get the cache for the provider rule with the given name, or the repo's own provider if the name is "".
+func (c *Caches) Get(name string) (Cache, error) {
+	if cache, ok := c.caches[name]; ok {
+		return cache, nil
+	}
+	var cache Cache
+	var err error
+	if c.mem {
+		cache, err = memory.Setup()
+	} else if name == "" {
+		cache, err = disk.Setup(c.config)
+	} else {
+		cache, err = disk.SetupDir(filepath.Join(c.config.Root, disk.CacheDirName, "providers", name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.caches[name] = cache
+	return cache, nil
+}
+
+// Close all of the caches that have been opened.
+func (c *Caches) Close() error {
+	var err error
+	for _, cache := range c.caches {
+		if closeErr := cache.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -1,6 +1,9 @@
 package common
 
-import "crypto/sha256"
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
 
 const (
 	// Length to hash plaintext and ciphertext keys.
@@ -9,14 +12,18 @@ const (
 	plaintextKeyPrefix = 'p'
 	// Prefix for keys containing a hashed ciphertext, used to look up plaintext.
 	ciphertextKeyPrefix = 'c'
+	// Prefix for keys containing a hashed plaintext and the additional authenticated data it's bound to, used to look up ciphertext.
+	boundPlaintextKeyPrefix = 'P'
+	// Prefix for keys containing a hashed ciphertext and the additional authenticated data it's bound to, used to look up plaintext.
+	boundCiphertextKeyPrefix = 'C'
 )
 
-// Convert a plaintext to the key used to lookup its ciphertext.
-func PlaintextToKey(data string) []byte {
-	key := make([]byte, 1, hashLength+1)
-	key[0] = plaintextKeyPrefix
-	key = append(key, hash([]byte(data))...)
-	return key
+// Convert a plaintext, and the additional authenticated data it's bound to (if any), to the key used to lookup its ciphertext.
+func PlaintextToKey(data string, aad []byte) []byte {
+	if len(aad) == 0 {
+		return toKey(plaintextKeyPrefix, hash([]byte(data)))
+	}
+	return toKey(boundPlaintextKeyPrefix, hashBound([]byte(data), aad))
 }
 
 // Hash some bytes, truncating the length to the hashLength constant.
@@ -25,10 +32,24 @@ func hash(data []byte) []byte {
 	return result[:hashLength]
 }
 
-// Convert a ciphertext to the key used to lookup its plaintext.
-func CiphertextToKey(data []byte) []byte {
+// Hash some bytes along with the additional authenticated data they're bound to, truncating the length to the hashLength constant.
+func hashBound(data []byte, aad []byte) []byte {
+	input := make([]byte, 4, 4+len(aad)+len(data))
+	binary.BigEndian.PutUint32(input, uint32(len(aad)))
+	input = append(append(input, aad...), data...)
+	return hash(input)
+}
+
+func toKey(prefix byte, hash []byte) []byte {
 	key := make([]byte, 1, hashLength+1)
-	key[0] = ciphertextKeyPrefix
-	key = append(key, hash(data)...)
-	return key
+	key[0] = prefix
+	return append(key, hash...)
+}
+
+// Convert a ciphertext, and the additional authenticated data it's bound to (if any), to the key used to lookup its plaintext.
+func CiphertextToKey(data []byte, aad []byte) []byte {
+	if len(aad) == 0 {
+		return toKey(ciphertextKeyPrefix, hash(data))
+	}
+	return toKey(boundCiphertextKeyPrefix, hashBound(data, aad))
 }
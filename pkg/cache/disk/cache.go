@@ -36,13 +36,27 @@ type diskCache struct {
 
 // Initialize the cache.
 func Setup(config config.Config) (*diskCache, error) {
-	parentPath := filepath.Join(config.Root, CacheDirName)
+	return SetupDir(filepath.Join(config.Root, CacheDirName))
+}
+
+// Delete the cache in the given directory, leaving anything else in it alone.
+func RemoveDir(parentPath string) error {
+	for _, path := range []string{filepath.Join(parentPath, "young"), filepath.Join(parentPath, CacheDirName)} {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("Error deleting cache: %w", err)
+		}
+	}
+	return nil
+}
+
+// Initialize a cache in the given directory.
+func SetupDir(parentPath string) (*diskCache, error) {
 	cache := diskCache{
 		parentPath: parentPath,
 		youngPath:  filepath.Join(parentPath, "young"),
 		oldPath:    filepath.Join(parentPath, CacheDirName, "old"),
 	}
-	err := os.Mkdir(cache.parentPath, 0o700)
+	err := os.MkdirAll(cache.parentPath, 0o700)
 	if err != nil && !os.IsExist(err) {
 		return nil, fmt.Errorf("Error creating new cache: %w", err)
 	}
@@ -102,13 +116,13 @@ func (c *diskCache) Close() error {
 }
 
 // Look up the ciphertext for a given plaintext. Protected with a mutex.
-func (c *diskCache) Encrypt(plaintext string, potentialCiphertext []byte) ([]byte, bool, error) {
+func (c *diskCache) Encrypt(plaintext string, aad []byte, potentialCiphertext []byte) ([]byte, bool, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	// if the potentialCiphertext is in the cache, and has a plaintext equal to the plaintext being encrypted, that's the ciphertext!
 	if len(potentialCiphertext) > 0 {
-		potentialCiphertextPlaintext, ok, err := c.get(common.CiphertextToKey(potentialCiphertext))
+		potentialCiphertextPlaintext, ok, err := c.get(common.CiphertextToKey(potentialCiphertext, aad))
 		if err != nil {
 			return []byte{}, false, fmt.Errorf("Error looking up potentialCiphertext in cache: %w", err)
 		}
@@ -117,7 +131,7 @@ func (c *diskCache) Encrypt(plaintext string, potentialCiphertext []byte) ([]byt
 		}
 	}
 	// potentialCiphertext wasn't it, so return an arbitrary ciphertext that encrypts the given plaintext.
-	ciphertext, ok, err := c.get(common.PlaintextToKey(plaintext))
+	ciphertext, ok, err := c.get(common.PlaintextToKey(plaintext, aad))
 	if err != nil {
 		return []byte{}, false, fmt.Errorf("Error looking up plaintext in cache: %w", err)
 	}
@@ -125,10 +139,10 @@ func (c *diskCache) Encrypt(plaintext string, potentialCiphertext []byte) ([]byt
 }
 
 // Look up the plaintext for a given ciphertext. Protected with a mutex.
-func (c *diskCache) Decrypt(ciphertext []byte) (string, bool, error) {
+func (c *diskCache) Decrypt(ciphertext []byte, aad []byte) (string, bool, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	plaintext, ok, err := c.get(common.CiphertextToKey(ciphertext))
+	plaintext, ok, err := c.get(common.CiphertextToKey(ciphertext, aad))
 	if err != nil {
 		err = fmt.Errorf("Error looking up ciphertext in cache: %w", err)
 	}
@@ -136,10 +150,10 @@ func (c *diskCache) Decrypt(ciphertext []byte) (string, bool, error) {
 }
 
 // Add a (plaintext, ciphertext) pair to the young cache. Protected with a mutex.
-func (c *diskCache) Add(plaintext string, ciphertext []byte) error {
+func (c *diskCache) Add(plaintext string, aad []byte, ciphertext []byte) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	err := c.add(plaintext, ciphertext)
+	err := c.add(plaintext, aad, ciphertext)
 	if err != nil {
 		return fmt.Errorf("Error adding item to cache: %w", err)
 	}
@@ -147,12 +161,12 @@ func (c *diskCache) Add(plaintext string, ciphertext []byte) error {
 }
 
 // Add a (plaintext, ciphertext) pair to the young cache.
-func (c *diskCache) add(plaintext string, ciphertext []byte) error {
-	err := c.young.Put(common.PlaintextToKey(plaintext), ciphertext)
+func (c *diskCache) add(plaintext string, aad []byte, ciphertext []byte) error {
+	err := c.young.Put(common.PlaintextToKey(plaintext, aad), ciphertext)
 	if err != nil {
 		return err
 	}
-	return c.young.Put(common.CiphertextToKey(ciphertext), []byte(plaintext))
+	return c.young.Put(common.CiphertextToKey(ciphertext, aad), []byte(plaintext))
 }
 
 func (c *diskCache) get(key []byte) (value []byte, ok bool, err error) {
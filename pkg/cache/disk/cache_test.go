@@ -69,6 +69,44 @@ func TestCache(t *testing.T) {
 	}
 }
 
+func TestBoundEntries(t *testing.T) {
+	repos, err := fixtures.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repos[0]
+	err = repo.Setup()
+	defer repo.Destroy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := config.LoadConfig(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := Setup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	aad := []byte("file\n\"key\"")
+	err = cache.Add(plaintext(0, 0), aad, ciphertext(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, other := range [][]byte{nil, []byte("file\n\"other key\"")} {
+		if _, ok, _ := cache.Encrypt(plaintext(0, 0), other, []byte{}); ok {
+			t.Errorf("Entry bound to %s found when encrypting with AAD %s", strconv.Quote(string(aad)), strconv.Quote(string(other)))
+		}
+		if _, ok, _ := cache.Decrypt(ciphertext(0, 0), other); ok {
+			t.Errorf("Entry bound to %s found when decrypting with AAD %s", strconv.Quote(string(aad)), strconv.Quote(string(other)))
+		}
+	}
+	if pt, ok, _ := cache.Decrypt(ciphertext(0, 0), aad); !ok || pt != plaintext(0, 0) {
+		t.Errorf("Entry bound to %s not found when decrypting with the same AAD", strconv.Quote(string(aad)))
+	}
+}
+
 // generates the plaintext for a particular round/item
 func plaintext(round, item int) string {
 	return fmt.Sprintf("Plaintext for round %02d, item %02d", round, item)
@@ -90,6 +128,7 @@ func putItems(t *testing.T, cache *diskCache, round int) {
 		for version := 0; version < 3; version++ {
 			err := cache.Add(
 				plaintext(round, item),
+				nil,
 				versionedCiphertext(round, item, version),
 			)
 			if err != nil {
@@ -103,7 +142,7 @@ func putItems(t *testing.T, cache *diskCache, round int) {
 func getItems(t *testing.T, cache *diskCache, round int, shouldSucceed bool) {
 	for item := 0; item < 100; item++ {
 		for version := 0; item < 3; item++ {
-			ct, ok, err := cache.Encrypt(plaintext(round, item), versionedCiphertext(round, item, version))
+			ct, ok, err := cache.Encrypt(plaintext(round, item), nil, versionedCiphertext(round, item, version))
 			if err != nil {
 				t.Error(err.Error())
 			}
@@ -118,7 +157,7 @@ func getItems(t *testing.T, cache *diskCache, round int, shouldSucceed bool) {
 				t.Errorf("Entry should not exist, but encrypting returned non-empty []bytes when encrypting %s", strconv.Quote(plaintext(round, item)))
 			}
 
-			pt, ok, err := cache.Decrypt(versionedCiphertext(round, item, version))
+			pt, ok, err := cache.Decrypt(versionedCiphertext(round, item, version), nil)
 			if err != nil {
 				t.Error(err.Error())
 			}
@@ -135,7 +174,7 @@ func getItems(t *testing.T, cache *diskCache, round int, shouldSucceed bool) {
 		}
 		if shouldSucceed {
 			// try encrypting with an invalid possibleCiphertext. Result should be an arbitrary valid ciphertext.
-			ct, ok, err := cache.Encrypt(plaintext(round, item), []byte("invalid ciphertext"))
+			ct, ok, err := cache.Encrypt(plaintext(round, item), nil, []byte("invalid ciphertext"))
 			if err != nil {
 				t.Error(err.Error())
 			}
@@ -21,32 +21,32 @@ func (c *memoryCache) Close() error {
 	return nil
 }
 
-func (c *memoryCache) Add(plaintext string, ciphertext []byte) error {
+func (c *memoryCache) Add(plaintext string, aad []byte, ciphertext []byte) error {
 	c.m.Lock()
 	defer c.m.Unlock()
-	c.c[string(common.PlaintextToKey(plaintext))] = string(ciphertext)
-	c.c[string(common.CiphertextToKey(ciphertext))] = plaintext
+	c.c[string(common.PlaintextToKey(plaintext, aad))] = string(ciphertext)
+	c.c[string(common.CiphertextToKey(ciphertext, aad))] = plaintext
 	return nil
 }
 
-func (c *memoryCache) Encrypt(plaintext string, potentialCiphertext []byte) ([]byte, bool, error) {
+func (c *memoryCache) Encrypt(plaintext string, aad []byte, potentialCiphertext []byte) ([]byte, bool, error) {
 	c.m.RLock()
 	defer c.m.RUnlock()
 	// if the potentialCiphertext is in the cache, and has a plaintext equal to the plaintext being encrypted, that's the ciphertext!
 	if len(potentialCiphertext) > 0 {
-		potentialCiphertextPlaintext, ok := c.c[string(common.CiphertextToKey(potentialCiphertext))]
+		potentialCiphertextPlaintext, ok := c.c[string(common.CiphertextToKey(potentialCiphertext, aad))]
 		if ok && string(potentialCiphertextPlaintext) == plaintext {
 			return potentialCiphertext, ok, nil
 		}
 	}
 	// potentialCiphertext wasn't it, so return an arbitrary ciphertext that encrypts the given plaintext.
-	ciphertext, ok := c.c[string(common.PlaintextToKey(plaintext))]
+	ciphertext, ok := c.c[string(common.PlaintextToKey(plaintext, aad))]
 	return []byte(ciphertext), ok, nil
 }
 
-func (c *memoryCache) Decrypt(ciphertext []byte) (string, bool, error) {
+func (c *memoryCache) Decrypt(ciphertext []byte, aad []byte) (string, bool, error) {
 	c.m.RLock()
 	defer c.m.RUnlock()
-	plaintext, ok := c.c[string(common.CiphertextToKey(ciphertext))]
+	plaintext, ok := c.c[string(common.CiphertextToKey(ciphertext, aad))]
 	return plaintext, ok, nil
 }
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/farmersedgeinc/yaml-crypt/pkg/crypto"
 	"gopkg.in/yaml.v3"
 	"os"
@@ -25,23 +28,28 @@ func (c *SuffixesConfig) GitignoreSet() map[string]bool {
 }
 
 func (c *SuffixesConfig) UnmarshalYAML(node *yaml.Node) error {
+	return c.decode(node, DefaultSuffixesConfig)
+}
+
+// Decode a suffixes config, using the given defaults for any suffixes that aren't set.
+func (c *SuffixesConfig) decode(node *yaml.Node, defaults SuffixesConfig) error {
 	tmp := map[string]string{}
 	err := node.Decode(tmp)
 	if err != nil {
 		return err
 	}
 	if tmp["encrypted"] == "" {
-		c.Encrypted = DefaultSuffixesConfig.Encrypted
+		c.Encrypted = defaults.Encrypted
 	} else {
 		c.Encrypted = strings.TrimPrefix(tmp["encrypted"], ".")
 	}
 	if tmp["decrypted"] == "" {
-		c.Decrypted = DefaultSuffixesConfig.Decrypted
+		c.Decrypted = defaults.Decrypted
 	} else {
 		c.Decrypted = strings.TrimPrefix(tmp["decrypted"], ".")
 	}
 	if tmp["plain"] == "" {
-		c.Plain = DefaultSuffixesConfig.Plain
+		c.Plain = defaults.Plain
 	} else {
 		c.Plain = strings.TrimPrefix(tmp["plain"], ".")
 	}
@@ -54,17 +62,90 @@ var DefaultSuffixesConfig = SuffixesConfig{
 	Plain:     "plain.yaml",
 }
 
+var DefaultJSONSuffixesConfig = SuffixesConfig{
+	Encrypted: "encrypted.json",
+	Decrypted: "decrypted.json",
+	Plain:     "plain.json",
+}
+
+var DefaultDotenvSuffixesConfig = SuffixesConfig{
+	Encrypted: "encrypted.env",
+	Decrypted: "decrypted.env",
+	Plain:     "plain.env",
+}
+
+// Decode an optional set of suffixes for files in another format, which must all end with the format's extension.
+func decodeFormatSuffixes(node *yaml.Node, defaults SuffixesConfig, extension string) (SuffixesConfig, error) {
+	var c SuffixesConfig
+	if node == nil {
+		return c, nil
+	}
+	if err := c.decode(node, defaults); err != nil {
+		return c, err
+	}
+	for _, suffix := range []string{c.Encrypted, c.Decrypted, c.Plain} {
+		if !strings.HasSuffix(suffix, extension) {
+			return c, fmt.Errorf("Suffix %s must end with %s", suffix, extension)
+		}
+	}
+	return c, nil
+}
+
+// A rule marking values as secrets by their paths, even if they aren't tagged !secret.
+type SecretRule struct {
+	// Glob matched against the paths of files relative to the repo root, without their suffixes. ** matches any number of directories. Empty matches every file.
+	Files string
+	// Patterns matched against the paths of values in matching files, like **.password, data.*, or /^db\..*_key$/.
+	Paths []string
+}
+
+// Whether the rule applies to a file, given its path relative to the repo root without its suffix.
+func (r *SecretRule) Matches(name string) bool {
+	return MatchGlob(r.Files, name)
+}
+
+// A rule encrypting files with a different provider than the rest of the repo.
+type ProviderRule struct {
+	// Glob matched against the paths of files relative to the repo root, without their suffixes. ** matches any number of directories.
+	Files    string
+	Provider crypto.Provider
+	// Identifies the provider's configuration, so its ciphertexts can be cached separately from other providers'.
+	Name string
+}
+
 type Config struct {
 	Provider crypto.Provider
 	Suffixes SuffixesConfig
-	Root     string
+	// Suffixes for JSON files, or all empty if JSON files aren't managed.
+	JSONSuffixes SuffixesConfig
+	// Suffixes for dotenv files, or all empty if dotenv files aren't managed.
+	DotenvSuffixes SuffixesConfig
+	Root           string
+	// Whether to bind each ciphertext to the file and path it's found at, so it can't be moved elsewhere.
+	BindPaths   bool
+	SecretRules []SecretRule
+	// Whether to treat every value in the data and stringData of Kubernetes Secrets as a secret.
+	KubernetesSecrets bool
+	// Rules for files that use their own providers, in order of precedence.
+	ProviderRules []ProviderRule
 }
 
 func (c *Config) UnmarshalYAML(node *yaml.Node) error {
-	type tmp struct {
+	type providerRule struct {
+		Files    string
 		Provider string
 		Config   map[string]interface{}
-		Suffixes SuffixesConfig
+	}
+	type tmp struct {
+		Provider          string
+		Config            map[string]interface{}
+		Suffixes          SuffixesConfig
+		JSONSuffixes      *yaml.Node     `yaml:"jsonSuffixes"`
+		DotenvSuffixes    *yaml.Node     `yaml:"dotenvSuffixes"`
+		BindPaths         bool           `yaml:"bindPaths"`
+		KubernetesSecrets bool           `yaml:"kubernetesSecrets"`
+		SecretRules       []SecretRule   `yaml:"secretRules"`
+		ProviderRules     []providerRule `yaml:"providerRules"`
 	}
 	var t tmp
 	err := node.Decode(&t)
@@ -72,15 +153,84 @@ func (c *Config) UnmarshalYAML(node *yaml.Node) error {
 		return err
 	}
 
-	provider, err := crypto.NewProvider(t.Provider, t.Config)
+	provider, err := crypto.NewProvider(t.Provider, t.Config, c.Root)
 	if err != nil {
 		return err
 	}
 	c.Provider = provider
 	c.Suffixes = t.Suffixes
+	if c.JSONSuffixes, err = decodeFormatSuffixes(t.JSONSuffixes, DefaultJSONSuffixesConfig, ".json"); err != nil {
+		return fmt.Errorf("Error in .jsonSuffixes: %w", err)
+	}
+	if c.DotenvSuffixes, err = decodeFormatSuffixes(t.DotenvSuffixes, DefaultDotenvSuffixesConfig, ".env"); err != nil {
+		return fmt.Errorf("Error in .dotenvSuffixes: %w", err)
+	}
+	c.BindPaths = t.BindPaths
+	c.KubernetesSecrets = t.KubernetesSecrets
+	c.SecretRules = t.SecretRules
+	c.ProviderRules = nil
+	for i, rule := range t.ProviderRules {
+		if rule.Files == "" {
+			return fmt.Errorf("Error in .providerRules[%d]: files is required", i)
+		}
+		provider, err := crypto.NewProvider(rule.Provider, rule.Config, c.Root)
+		if err != nil {
+			return fmt.Errorf("Error in .providerRules[%d]: %w", i, err)
+		}
+		// the same provider configuration always gets the same name, wherever the rule is
+		b, err := yaml.Marshal(map[string]interface{}{"provider": rule.Provider, "config": rule.Config})
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(b)
+		c.ProviderRules = append(c.ProviderRules, ProviderRule{
+			Files:    rule.Files,
+			Provider: provider,
+			Name:     hex.EncodeToString(hash[:8]),
+		})
+	}
 	return nil
 }
 
+// Get the provider for a file, given its path relative to the repo root without its suffix, along with the name of the provider rule it comes from, or "" if it's the repo's own provider.
+func (c *Config) ProviderFor(name string) (string, crypto.Provider) {
+	for _, rule := range c.ProviderRules {
+		if MatchGlob(rule.Files, name) {
+			return rule.Name, rule.Provider
+		}
+	}
+	return "", c.Provider
+}
+
+// Match a "/"-separated file path against a glob, where ** matches any number of directories. An empty glob matches every file.
+func MatchGlob(pattern string, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	return matchGlob(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlob(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchGlob(pattern[1:], segments[1:])
+}
+
 func FindRepoRoot(dir string) (string, error) {
 	path, err := findConfigFile(dir)
 	return filepath.Dir(path), err
@@ -103,18 +253,24 @@ func findConfigFile(dir string) (string, error) {
 }
 
 func LoadConfig(dir string) (Config, error) {
-	var c Config
 	path, err := findConfigFile(dir)
 	if err != nil {
-		return c, err
+		return Config{}, err
 	}
+	return LoadConfigFile(path, filepath.Dir(path))
+}
+
+// Load a config file from an arbitrary path, for the repo at root.
+func LoadConfigFile(path string, root string) (Config, error) {
+	var c Config
 	f, err := os.Open(path)
 	defer f.Close()
 	if err != nil {
 		return c, err
 	}
+	// the root needs to be known while decoding, to resolve relative paths in the provider config
+	c.Root = root
 	err = yaml.NewDecoder(f).Decode(&c)
-	c.Root = filepath.Dir(path)
 	return c, err
 }
 
@@ -123,7 +279,7 @@ func (c *Config) allFiles(dir string, suffix string) ([]string, error) {
 	err := filepath.Walk(
 		dir,
 		func(path string, info os.FileInfo, err error) error {
-			if (info == nil || !info.IsDir()) && strings.HasSuffix(path, suffix) {
+			if (info == nil || !info.IsDir()) && HasSuffix(path, suffix) {
 				out = append(out, path)
 			}
 			if !os.IsNotExist(err) {
@@ -135,14 +291,67 @@ func (c *Config) allFiles(dir string, suffix string) ([]string, error) {
 	return out, err
 }
 
+// Get every set of suffixes in use: the yaml suffixes, followed by the JSON and dotenv suffixes if those files are managed.
+func (c *Config) AllSuffixes() []SuffixesConfig {
+	out := []SuffixesConfig{c.Suffixes}
+	for _, suffixes := range []SuffixesConfig{c.JSONSuffixes, c.DotenvSuffixes} {
+		if suffixes != (SuffixesConfig{}) {
+			out = append(out, suffixes)
+		}
+	}
+	return out
+}
+
+// Get all files under dir with any of the suffixes picked out of each set of suffixes.
+func (c *Config) allFilesWithSuffix(dir string, suffix func(SuffixesConfig) string) ([]string, error) {
+	var out []string
+	for _, suffixes := range c.AllSuffixes() {
+		paths, err := c.allFiles(dir, suffix(suffixes))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, paths...)
+	}
+	return out, nil
+}
+
 func (c *Config) AllEncryptedFiles(dir string) ([]string, error) {
-	return c.allFiles(dir, c.Suffixes.Encrypted)
+	return c.allFilesWithSuffix(dir, func(s SuffixesConfig) string { return s.Encrypted })
 }
 
 func (c *Config) AllDecryptedFiles(dir string) ([]string, error) {
-	return c.allFiles(dir, c.Suffixes.Decrypted)
+	return c.allFilesWithSuffix(dir, func(s SuffixesConfig) string { return s.Decrypted })
 }
 
 func (c *Config) AllPlainFiles(dir string) ([]string, error) {
-	return c.allFiles(dir, c.Suffixes.Plain)
+	return c.allFilesWithSuffix(dir, func(s SuffixesConfig) string { return s.Plain })
+}
+
+// Whether a file name ends with a suffix, separated from the rest of the name by a ".", like the gitignore patterns for the suffixes expect. explain.yaml doesn't end with the suffix plain.yaml, but secrets.plain.yaml does.
+func HasSuffix(name string, suffix string) bool {
+	base := filepath.Base(name)
+	if suffix == "" || len(base) <= len(suffix) || !strings.HasSuffix(base, suffix) {
+		return false
+	}
+	return strings.HasPrefix(suffix, ".") || base[len(base)-len(suffix)-1] == '.'
+}
+
+// Whether a file name ends with any of the encrypted suffixes.
+func (c *Config) IsEncryptedFile(name string) bool {
+	for _, suffixes := range c.AllSuffixes() {
+		if HasSuffix(name, suffixes.Encrypted) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a file name ends with any of the decrypted or plain suffixes.
+func (c *Config) IsPlaintextFile(name string) bool {
+	for _, suffixes := range c.AllSuffixes() {
+		if HasSuffix(name, suffixes.Decrypted) || HasSuffix(name, suffixes.Plain) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,153 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+)
+
+// AgeProvider encrypts to one or more age recipients, and decrypts with age identities, entirely offline.
+// If Identities is empty, they are loaded from the files listed in $YAMLCRYPT_AGE_KEY_FILE, or from ~/.config/yaml-crypt/age/keys.txt.
+type AgeProvider struct {
+	Recipients []age.Recipient
+	Identities []age.Identity
+}
+
+func parseAgeRecipients(recipients []string) ([]age.Recipient, error) {
+	out := make([]age.Recipient, 0, len(recipients))
+	for _, r := range recipients {
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(r))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid age recipient %s: %w", r, err)
+		}
+		out = append(out, recipient)
+	}
+	return out, nil
+}
+
+// Get the paths of the files that age identities are loaded from.
+func AgeIdentityFiles() ([]string, error) {
+	if paths := os.Getenv("YAMLCRYPT_AGE_KEY_FILE"); paths != "" {
+		return filepath.SplitList(paths), nil
+	}
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+	return []string{filepath.Join(configDir, "yaml-crypt", "age", "keys.txt")}, nil
+}
+
+func (p AgeProvider) identities() ([]age.Identity, error) {
+	if len(p.Identities) > 0 {
+		return p.Identities, nil
+	}
+	paths, err := AgeIdentityFiles()
+	if err != nil {
+		return nil, err
+	}
+	var out []age.Identity
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		identities, err := age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading age identities from %s: %w", path, err)
+		}
+		out = append(out, identities...)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("No age identities found in %s", strings.Join(paths, ", "))
+	}
+	return out, nil
+}
+
+const (
+	// The version of the header that age plaintexts are prefixed with.
+	ageHeaderVersion = 1
+	ageUnbound       = 0
+	ageBound         = 1
+)
+
+// age has no native support for AAD, so the plaintext is prefixed with a header: a version byte, a flag for whether it's bound to any AAD, and if it is, a hash of the AAD. The whole header is checked on decryption, so a bound ciphertext is never mistaken for an unbound one, or vice versa.
+func ageHeader(aad []byte) []byte {
+	if len(aad) == 0 {
+		return []byte{ageHeaderVersion, ageUnbound}
+	}
+	sum := sha256.Sum256(aad)
+	return append([]byte{ageHeaderVersion, ageBound}, sum[:]...)
+}
+
+func (p AgeProvider) Encrypt(plaintext string, retries uint, timeout time.Duration) ([]byte, error) {
+	return p.EncryptWithAAD(plaintext, nil, retries, timeout)
+}
+
+func (p AgeProvider) EncryptWithAAD(plaintext string, aad []byte, _ uint, _ time.Duration) ([]byte, error) {
+	if len(p.Recipients) == 0 {
+		return []byte{}, errors.New("No age recipients configured")
+	}
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, p.Recipients...)
+	if err != nil {
+		return []byte{}, err
+	}
+	if _, err = w.Write(ageHeader(aad)); err != nil {
+		return []byte{}, err
+	}
+	if _, err = io.WriteString(w, plaintext); err != nil {
+		return []byte{}, err
+	}
+	if err = w.Close(); err != nil {
+		return []byte{}, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p AgeProvider) Decrypt(ciphertext []byte, retries uint, timeout time.Duration) (string, error) {
+	return p.DecryptWithAAD(ciphertext, nil, retries, timeout)
+}
+
+func (p AgeProvider) DecryptWithAAD(ciphertext []byte, aad []byte, _ uint, _ time.Duration) (string, error) {
+	identities, err := p.identities()
+	if err != nil {
+		return "", err
+	}
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), identities...)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if len(plaintext) < 2 || plaintext[0] != ageHeaderVersion {
+		return "", errors.New("Unsupported age ciphertext version")
+	}
+	if bound := plaintext[1] == ageBound; bound && len(aad) == 0 {
+		return "", errors.New("Ciphertext is bound to additional authenticated data, but none was given")
+	} else if !bound && len(aad) > 0 {
+		return "", errors.New("Ciphertext is not bound to any additional authenticated data")
+	}
+	header := ageHeader(aad)
+	if !bytes.HasPrefix(plaintext, header) {
+		return "", errors.New("Ciphertext is not bound to the given additional authenticated data")
+	}
+	return string(plaintext[len(header):]), nil
+}
@@ -0,0 +1,119 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+type AWSProvider struct {
+	Key      string
+	Region   string
+	Profile  string
+	Endpoint string
+}
+
+func (p AWSProvider) client() (*kms.KMS, error) {
+	config := aws.Config{
+		Region: aws.String(p.Region),
+		// retries are handled by the retry helper, so they behave the same as other providers
+		MaxRetries: aws.Int(0),
+	}
+	if p.Endpoint != "" {
+		config.Endpoint = aws.String(p.Endpoint)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            config,
+		Profile:           p.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kms.New(sess), nil
+}
+
+func awsErrorRetryable(err error) bool {
+	var re awserr.RequestFailure
+	var ae awserr.Error
+	if _, ok := err.(net.Error); ok {
+		return true
+	} else if errors.As(err, &re) {
+		code := re.StatusCode()
+		return code >= 500 || code == 429 || request.IsErrorThrottle(re)
+	} else if errors.As(err, &ae) {
+		switch ae.Code() {
+		case request.ErrCodeRequestError, request.ErrCodeResponseTimeout:
+			return true
+		}
+		return request.IsErrorThrottle(ae)
+	}
+	return false
+}
+
+// AAD is passed to KMS as the encryption context.
+func awsEncryptionContext(aad []byte) map[string]*string {
+	if len(aad) == 0 {
+		return nil
+	}
+	return map[string]*string{"yaml-crypt": aws.String(string(aad))}
+}
+
+func (p AWSProvider) Encrypt(plaintext string, retries uint, timeout time.Duration) ([]byte, error) {
+	return p.EncryptWithAAD(plaintext, nil, retries, timeout)
+}
+
+func (p AWSProvider) EncryptWithAAD(plaintext string, aad []byte, retries uint, timeout time.Duration) ([]byte, error) {
+	var result *kms.EncryptOutput
+	f := func(ctx context.Context) error {
+		client, err := p.client()
+		if err != nil {
+			return err
+		}
+		result, err = client.EncryptWithContext(ctx, &kms.EncryptInput{
+			KeyId:             aws.String(p.Key),
+			Plaintext:         []byte(plaintext),
+			EncryptionContext: awsEncryptionContext(aad),
+		})
+		return err
+	}
+	err := retry(f, awsErrorRetryable, retries, timeout)
+	if err != nil {
+		return []byte{}, err
+	} else {
+		return result.CiphertextBlob, err
+	}
+}
+
+func (p AWSProvider) Decrypt(ciphertext []byte, retries uint, timeout time.Duration) (string, error) {
+	return p.DecryptWithAAD(ciphertext, nil, retries, timeout)
+}
+
+func (p AWSProvider) DecryptWithAAD(ciphertext []byte, aad []byte, retries uint, timeout time.Duration) (string, error) {
+	var result *kms.DecryptOutput
+	f := func(ctx context.Context) error {
+		client, err := p.client()
+		if err != nil {
+			return err
+		}
+		result, err = client.DecryptWithContext(ctx, &kms.DecryptInput{
+			KeyId:             aws.String(p.Key),
+			CiphertextBlob:    ciphertext,
+			EncryptionContext: awsEncryptionContext(aad),
+		})
+		return err
+	}
+	err := retry(f, awsErrorRetryable, retries, timeout)
+	if err != nil {
+		return "", err
+	} else {
+		return string(result.Plaintext), err
+	}
+}
@@ -0,0 +1,182 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// Format version of the ciphertexts produced by EnvelopeProvider.
+	envelopeVersion = 2
+	// Length of the randomly-generated data keys.
+	envelopeDataKeyLength = 32
+)
+
+// EnvelopeProvider encrypts each value locally with a random AES-256-GCM data key, and wraps the data key with every one of its Providers, so that any one of them is able to decrypt it.
+// Ciphertexts are laid out as: a version byte, the number of wrapped keys, each wrapped key prefixed with its 4-byte length, the nonce, then the sealed plaintext. Everything before the nonce is the header, which is authenticated along with the plaintext, so wrapped keys can't be swapped or edited.
+// Wrapped keys are stored in the same order as Providers, so providers should only ever be appended to the list.
+type EnvelopeProvider struct {
+	Providers []Provider
+}
+
+func newEnvelopeProvider(config map[string]interface{}, root string) (Provider, error) {
+	value, ok := config["providers"]
+	if !ok || value == nil {
+		return nil, errors.New("Required setting: .config.providers")
+	}
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, errors.New(".config.providers must be a non-empty list")
+	}
+	if len(list) > 255 {
+		return nil, errors.New(".config.providers can have at most 255 entries")
+	}
+	providers := make([]Provider, len(list))
+	for i, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf(".config.providers[%d] must be a map", i)
+		}
+		name, err := getString(entry, "provider")
+		if err != nil {
+			return nil, fmt.Errorf(".config.providers[%d]: %w", i, err)
+		}
+		if name == "envelope" {
+			return nil, fmt.Errorf(".config.providers[%d]: envelope providers can't be nested", i)
+		}
+		providerConfig, _ := entry["config"].(map[string]interface{})
+		if providerConfig == nil {
+			providerConfig = map[string]interface{}{}
+		}
+		providers[i], err = NewProvider(name, providerConfig, root)
+		if err != nil {
+			return nil, fmt.Errorf(".config.providers[%d]: %w", i, err)
+		}
+	}
+	return EnvelopeProvider{Providers: providers}, nil
+}
+
+// Get the additional data the plaintext is sealed with: the header, followed by the AAD the ciphertext is bound to, if any. The header records its own length, so the two can't be confused.
+func envelopeAdditionalData(header []byte, aad []byte) []byte {
+	out := make([]byte, 0, len(header)+len(aad))
+	return append(append(out, header...), aad...)
+}
+
+func newDataKeyAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (p EnvelopeProvider) Encrypt(plaintext string, retries uint, timeout time.Duration) ([]byte, error) {
+	return p.EncryptWithAAD(plaintext, nil, retries, timeout)
+}
+
+// The AAD only needs to be bound to the locally-encrypted value, so the wrapping providers don't need to support it.
+func (p EnvelopeProvider) EncryptWithAAD(plaintext string, aad []byte, retries uint, timeout time.Duration) ([]byte, error) {
+	if len(p.Providers) == 0 {
+		return []byte{}, errors.New("No providers configured")
+	}
+	key := make([]byte, envelopeDataKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return []byte{}, fmt.Errorf("Error generating data key: %w", err)
+	}
+	out := []byte{envelopeVersion, byte(len(p.Providers))}
+	for i, provider := range p.Providers {
+		wrapped, err := provider.Encrypt(base64.StdEncoding.EncodeToString(key), retries, timeout)
+		if err != nil {
+			return []byte{}, fmt.Errorf("Error wrapping data key with provider %d: %w", i, err)
+		}
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(wrapped)))
+		out = append(append(out, length...), wrapped...)
+	}
+	aead, err := newDataKeyAEAD(key)
+	if err != nil {
+		return []byte{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return []byte{}, fmt.Errorf("Error generating nonce: %w", err)
+	}
+	additionalData := envelopeAdditionalData(out, aad)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, []byte(plaintext), additionalData), nil
+}
+
+// Split an envelope ciphertext into its wrapped keys, its header, and the locally-encrypted remainder.
+func parseEnvelope(ciphertext []byte) ([][]byte, []byte, []byte, error) {
+	if len(ciphertext) < 2 {
+		return nil, nil, nil, errors.New("Ciphertext is too short")
+	}
+	if ciphertext[0] != envelopeVersion {
+		return nil, nil, nil, fmt.Errorf("Unsupported ciphertext version %d", ciphertext[0])
+	}
+	wrapped := make([][]byte, ciphertext[1])
+	rest := ciphertext[2:]
+	for i := range wrapped {
+		if len(rest) < 4 {
+			return nil, nil, nil, errors.New("Ciphertext is truncated")
+		}
+		length := binary.BigEndian.Uint32(rest)
+		rest = rest[4:]
+		if uint32(len(rest)) < length {
+			return nil, nil, nil, errors.New("Ciphertext is truncated")
+		}
+		wrapped[i] = rest[:length]
+		rest = rest[length:]
+	}
+	return wrapped, ciphertext[:len(ciphertext)-len(rest)], rest, nil
+}
+
+func (p EnvelopeProvider) Decrypt(ciphertext []byte, retries uint, timeout time.Duration) (string, error) {
+	return p.DecryptWithAAD(ciphertext, nil, retries, timeout)
+}
+
+func (p EnvelopeProvider) DecryptWithAAD(ciphertext []byte, aad []byte, retries uint, timeout time.Duration) (string, error) {
+	wrapped, header, sealed, err := parseEnvelope(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	// try each provider on the key it wrapped, until one of them works
+	var errs []string
+	var key []byte
+	for i := 0; i < len(wrapped) && i < len(p.Providers); i++ {
+		encodedKey, err := p.Providers[i].Decrypt(wrapped[i], retries, timeout)
+		if err == nil {
+			key, err = base64.StdEncoding.DecodeString(encodedKey)
+			if err == nil && len(key) != envelopeDataKeyLength {
+				err = fmt.Errorf("data key has length %d", len(key))
+			}
+		}
+		if err == nil {
+			break
+		}
+		key = nil
+		errs = append(errs, fmt.Sprintf("provider %d: %s", i, err))
+	}
+	if key == nil {
+		return "", fmt.Errorf("No provider could unwrap the data key: %s", strings.Join(errs, "; "))
+	}
+	aead, err := newDataKeyAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return "", errors.New("Ciphertext is truncated")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], envelopeAdditionalData(header, aad))
+	if err != nil {
+		return "", fmt.Errorf("Error decrypting ciphertext: %w", err)
+	}
+	return string(plaintext), nil
+}
@@ -41,6 +41,10 @@ func googleErrorRetryable(err error) bool {
 }
 
 func (p GoogleProvider) Encrypt(plaintext string, retries uint, timeout time.Duration) ([]byte, error) {
+	return p.EncryptWithAAD(plaintext, nil, retries, timeout)
+}
+
+func (p GoogleProvider) EncryptWithAAD(plaintext string, aad []byte, retries uint, timeout time.Duration) ([]byte, error) {
 	var result *kmspb.EncryptResponse
 	f := func(ctx context.Context) error {
 		client, err := kms.NewKeyManagementClient(ctx, p.Options...)
@@ -49,8 +53,9 @@ func (p GoogleProvider) Encrypt(plaintext string, retries uint, timeout time.Dur
 		}
 		defer client.Close()
 		result, err = client.Encrypt(ctx, &kmspb.EncryptRequest{
-			Name:      p.keyName(),
-			Plaintext: []byte(plaintext),
+			Name:                        p.keyName(),
+			Plaintext:                   []byte(plaintext),
+			AdditionalAuthenticatedData: aad,
 		})
 		return err
 	}
@@ -63,6 +68,10 @@ func (p GoogleProvider) Encrypt(plaintext string, retries uint, timeout time.Dur
 }
 
 func (p GoogleProvider) Decrypt(ciphertext []byte, retries uint, timeout time.Duration) (string, error) {
+	return p.DecryptWithAAD(ciphertext, nil, retries, timeout)
+}
+
+func (p GoogleProvider) DecryptWithAAD(ciphertext []byte, aad []byte, retries uint, timeout time.Duration) (string, error) {
 	var result *kmspb.DecryptResponse
 	f := func(ctx context.Context) error {
 		client, err := kms.NewKeyManagementClient(ctx, p.Options...)
@@ -71,8 +80,9 @@ func (p GoogleProvider) Decrypt(ciphertext []byte, retries uint, timeout time.Du
 		}
 		defer client.Close()
 		result, err = client.Decrypt(ctx, &kmspb.DecryptRequest{
-			Name:       p.keyName(),
-			Ciphertext: ciphertext,
+			Name:                        p.keyName(),
+			Ciphertext:                  ciphertext,
+			AdditionalAuthenticatedData: aad,
 		})
 		return err
 	}
@@ -0,0 +1,161 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Default name of the key file, relative to the repo root.
+	DefaultKeyfileName = ".yamlcrypt.key"
+	// Environment variable that can hold the base64-encoded key, instead of a file.
+	KeyfileEnvVar = "YAMLCRYPT_KEYFILE_KEY"
+	// Format version of the ciphertexts produced by KeyfileProvider.
+	keyfileVersion = 1
+	// Length of the key id stored in each ciphertext.
+	keyfileKeyIDLength = 8
+	// Length of the AES-256 key.
+	keyfileKeyLength = 32
+)
+
+// KeyfileProvider encrypts with AES-256-GCM, using a local key read from $YAMLCRYPT_KEYFILE_KEY, or from the file at Path.
+// Ciphertexts are self-describing: a version byte, the id of the key used, the random nonce, then the sealed plaintext.
+type KeyfileProvider struct {
+	Path string
+	Key  []byte
+}
+
+// Generate a new random key, and save it to the given path. Refuses to overwrite an existing file.
+func GenerateKeyfile(path string) error {
+	key := make([]byte, keyfileKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("Error generating key: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintln(f, base64.StdEncoding.EncodeToString(key)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func decodeKey(encoded string, source string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding key from %s: %w", source, err)
+	}
+	if len(key) != keyfileKeyLength {
+		return nil, fmt.Errorf("Key from %s must be %d bytes, not %d", source, keyfileKeyLength, len(key))
+	}
+	return key, nil
+}
+
+func (p KeyfileProvider) key() ([]byte, error) {
+	if len(p.Key) > 0 {
+		return p.Key, nil
+	}
+	if encoded := os.Getenv(KeyfileEnvVar); encoded != "" {
+		return decodeKey(encoded, "$"+KeyfileEnvVar)
+	}
+	if p.Path == "" {
+		return nil, fmt.Errorf("No key: set .config.path or $%s", KeyfileEnvVar)
+	}
+	encoded, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading key file: %w", err)
+	}
+	return decodeKey(string(encoded), p.Path)
+}
+
+func keyID(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:keyfileKeyIDLength]
+}
+
+func (p KeyfileProvider) aead() (cipher.AEAD, []byte, error) {
+	key, err := p.key()
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, keyID(key), err
+}
+
+func (p KeyfileProvider) Encrypt(plaintext string, retries uint, timeout time.Duration) ([]byte, error) {
+	return p.EncryptWithAAD(plaintext, nil, retries, timeout)
+}
+
+func (p KeyfileProvider) EncryptWithAAD(plaintext string, aad []byte, _ uint, _ time.Duration) ([]byte, error) {
+	aead, id, err := p.aead()
+	if err != nil {
+		return []byte{}, err
+	}
+	header := make([]byte, 1+keyfileKeyIDLength+aead.NonceSize())
+	header[0] = keyfileVersion
+	copy(header[1:], id)
+	nonce := header[1+keyfileKeyIDLength:]
+	if _, err := rand.Read(nonce); err != nil {
+		return []byte{}, fmt.Errorf("Error generating nonce: %w", err)
+	}
+	return aead.Seal(header, nonce, []byte(plaintext), aad), nil
+}
+
+func (p KeyfileProvider) Decrypt(ciphertext []byte, retries uint, timeout time.Duration) (string, error) {
+	return p.DecryptWithAAD(ciphertext, nil, retries, timeout)
+}
+
+func (p KeyfileProvider) DecryptWithAAD(ciphertext []byte, aad []byte, _ uint, _ time.Duration) (string, error) {
+	aead, id, err := p.aead()
+	if err != nil {
+		return "", err
+	}
+	headerLength := 1 + keyfileKeyIDLength + aead.NonceSize()
+	if len(ciphertext) < headerLength+aead.Overhead() {
+		return "", errors.New("Ciphertext is too short")
+	}
+	if ciphertext[0] != keyfileVersion {
+		return "", fmt.Errorf("Unsupported ciphertext version %d", ciphertext[0])
+	}
+	if !bytes.Equal(ciphertext[1:1+keyfileKeyIDLength], id) {
+		return "", fmt.Errorf("Ciphertext was encrypted with a different key (id %x, expected %x)", ciphertext[1:1+keyfileKeyIDLength], id)
+	}
+	nonce := ciphertext[1+keyfileKeyIDLength : headerLength]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[headerLength:], aad)
+	if err != nil {
+		return "", fmt.Errorf("Error decrypting ciphertext: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Resolve a key file path from the config: ~ is expanded, and relative paths are relative to the repo root.
+func resolveKeyfilePath(path string, root string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, path[1:]), nil
+	}
+	if path == "" || filepath.IsAbs(path) {
+		return path, nil
+	}
+	return filepath.Join(root, path), nil
+}
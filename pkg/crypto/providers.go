@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -12,6 +13,37 @@ type Provider interface {
 	Decrypt([]byte, uint, time.Duration) (string, error)
 }
 
+// A Provider that can bind ciphertexts to additional authenticated data (AAD). Decrypting a ciphertext fails unless it's given the same AAD it was encrypted with.
+type AADProvider interface {
+	Provider
+	EncryptWithAAD(string, []byte, uint, time.Duration) ([]byte, error)
+	DecryptWithAAD([]byte, []byte, uint, time.Duration) (string, error)
+}
+
+// Encrypt a plaintext with a provider, bound to the given AAD if it isn't empty.
+func Encrypt(provider Provider, plaintext string, aad []byte, retries uint, timeout time.Duration) ([]byte, error) {
+	if len(aad) == 0 {
+		return provider.Encrypt(plaintext, retries, timeout)
+	}
+	aadProvider, ok := provider.(AADProvider)
+	if !ok {
+		return []byte{}, fmt.Errorf("Provider %T does not support binding ciphertexts to additional authenticated data", provider)
+	}
+	return aadProvider.EncryptWithAAD(plaintext, aad, retries, timeout)
+}
+
+// Decrypt a ciphertext with a provider, checking that it's bound to the given AAD if it isn't empty.
+func Decrypt(provider Provider, ciphertext []byte, aad []byte, retries uint, timeout time.Duration) (string, error) {
+	if len(aad) == 0 {
+		return provider.Decrypt(ciphertext, retries, timeout)
+	}
+	aadProvider, ok := provider.(AADProvider)
+	if !ok {
+		return "", fmt.Errorf("Provider %T does not support binding ciphertexts to additional authenticated data", provider)
+	}
+	return aadProvider.DecryptWithAAD(ciphertext, aad, retries, timeout)
+}
+
 func getString(config map[string]interface{}, key string) (string, error) {
 	value, ok := config[key]
 	if !ok || value == "" {
@@ -24,7 +56,43 @@ func getString(config map[string]interface{}, key string) (string, error) {
 	return stringValue, nil
 }
 
-func NewProvider(name string, config map[string]interface{}) (Provider, error) {
+func getOptionalString(config map[string]interface{}, key string) (string, error) {
+	value, ok := config[key]
+	if !ok || value == nil {
+		return "", nil
+	}
+	stringValue, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf(".config.%s must be of type string", key)
+	}
+	return stringValue, nil
+}
+
+func getStringList(config map[string]interface{}, key string) ([]string, error) {
+	value, ok := config[key]
+	if !ok || value == nil {
+		return nil, fmt.Errorf("Required setting: .config.%s", key)
+	}
+	listValue, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf(".config.%s must be a list of strings", key)
+	}
+	out := make([]string, 0, len(listValue))
+	for _, item := range listValue {
+		stringItem, ok := item.(string)
+		if !ok || stringItem == "" {
+			return nil, fmt.Errorf(".config.%s must be a list of strings", key)
+		}
+		out = append(out, stringItem)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("Required setting: .config.%s", key)
+	}
+	return out, nil
+}
+
+// Create a provider from its name and the .config section of a config file. Relative paths in the config are relative to root.
+func NewProvider(name string, config map[string]interface{}, root string) (Provider, error) {
 	var provider Provider
 	var err error
 	switch name {
@@ -54,6 +122,114 @@ func NewProvider(name string, config map[string]interface{}) (Provider, error) {
 			Keyring:  keyring,
 			Key:      key,
 		}
+	case "aws":
+		key, err := getString(config, "key")
+		if err != nil {
+			return nil, err
+		}
+		region, err := getString(config, "region")
+		if err != nil {
+			return nil, err
+		}
+		profile, err := getOptionalString(config, "profile")
+		if err != nil {
+			return nil, err
+		}
+		endpoint, err := getOptionalString(config, "endpoint")
+		if err != nil {
+			return nil, err
+		}
+		provider = AWSProvider{
+			Key:      key,
+			Region:   region,
+			Profile:  profile,
+			Endpoint: endpoint,
+		}
+	case "vault":
+		address, err := getOptionalString(config, "address")
+		if err != nil {
+			return nil, err
+		}
+		if address == "" {
+			address = os.Getenv("VAULT_ADDR")
+		}
+		if address == "" {
+			return nil, fmt.Errorf("Required setting: .config.address (or $VAULT_ADDR)")
+		}
+		mount, err := getOptionalString(config, "mount")
+		if err != nil {
+			return nil, err
+		}
+		if mount == "" {
+			mount = "transit"
+		}
+		key, err := getString(config, "key")
+		if err != nil {
+			return nil, err
+		}
+		namespace, err := getOptionalString(config, "namespace")
+		if err != nil {
+			return nil, err
+		}
+		if namespace == "" {
+			namespace = os.Getenv("VAULT_NAMESPACE")
+		}
+		auth, err := getOptionalString(config, "auth")
+		if err != nil {
+			return nil, err
+		}
+		authMount, err := getOptionalString(config, "authMount")
+		if err != nil {
+			return nil, err
+		}
+		role, err := getOptionalString(config, "role")
+		if err != nil {
+			return nil, err
+		}
+		switch auth {
+		case "", "token", "approle":
+		case "kubernetes":
+			if role == "" {
+				return nil, fmt.Errorf("Required setting for kubernetes auth: .config.role")
+			}
+		default:
+			return nil, fmt.Errorf(".config.auth must be one of token, approle, kubernetes")
+		}
+		provider = VaultProvider{
+			Address:   address,
+			Mount:     mount,
+			Key:       key,
+			Namespace: namespace,
+			Auth:      auth,
+			AuthMount: authMount,
+			Role:      role,
+			token:     &vaultToken{},
+		}
+	case "age":
+		recipients, err := getStringList(config, "recipients")
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseAgeRecipients(recipients)
+		if err != nil {
+			return nil, err
+		}
+		provider = AgeProvider{Recipients: parsed}
+	case "keyfile":
+		path, err := getOptionalString(config, "path")
+		if err != nil {
+			return nil, err
+		}
+		path, err = resolveKeyfilePath(path, root)
+		if err != nil {
+			return nil, err
+		}
+		provider = KeyfileProvider{Path: path}
+	case "envelope":
+		provider, err = newEnvelopeProvider(config, root)
+		if err != nil {
+			return nil, err
+		}
 	default:
 		return nil, fmt.Errorf("No provider named %s", name)
 	}
@@ -70,21 +246,68 @@ var BlankConfigs map[string]interface{} = map[string]interface{}{
 		"keyring":  "",
 		"key":      "",
 	},
+	"aws": map[string]interface{}{
+		"key":      "",
+		"region":   "",
+		"profile":  "",
+		"endpoint": "",
+	},
+	"vault": map[string]interface{}{
+		"address": "",
+		"mount":   "transit",
+		"key":     "",
+		"auth":    "token",
+	},
+	"age": map[string]interface{}{
+		"recipients": []string{},
+	},
+	"keyfile": map[string]interface{}{
+		"path": DefaultKeyfileName,
+	},
+	"envelope": map[string]interface{}{
+		"providers": []interface{}{
+			map[string]interface{}{
+				"provider": "google",
+				"config": map[string]interface{}{
+					"project":  "",
+					"location": "global",
+					"keyring":  "",
+					"key":      "",
+				},
+			},
+			map[string]interface{}{
+				"provider": "age",
+				"config": map[string]interface{}{
+					"recipients": []string{},
+				},
+			},
+		},
+	},
 }
 
 type Operation func(context.Context) error
 
 func retry(operation Operation, isRetryable func(error) bool, retries uint, timeout time.Duration) error {
+	return retryContext(context.Background(), operation, isRetryable, retries, timeout)
+}
+
+// Run an operation up to retries times, each with its own timeout within parent. Attempts that run out of time are retried like retryable errors, unless parent is done too.
+func retryContext(parent context.Context, operation Operation, isRetryable func(error) bool, retries uint, timeout time.Duration) error {
 	var err error
 	for i := uint(0); i < retries; i++ {
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		defer cancel()
+		ctx, cancel := context.WithTimeout(parent, timeout)
 		err = operation(ctx)
+		ctxErr := ctx.Err()
+		cancel()
+		timedOut := errors.Is(ctxErr, context.DeadlineExceeded) && parent.Err() == nil
 		if err != nil {
-			if !isRetryable(err) {
+			if !timedOut && !isRetryable(err) {
 				return err
 			}
-		} else if err = ctx.Err(); err == nil {
+		} else if err = ctxErr; err == nil {
+			return err
+		}
+		if parent.Err() != nil {
 			return err
 		}
 		if i < retries-1 {
@@ -1,12 +1,18 @@
 package crypto
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"testing"
 	"time"
 
+	"filippo.io/age"
 	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
@@ -22,6 +28,12 @@ type ProviderMeta struct {
 const retries = 5
 const timeout = 10 * time.Second
 
+var ageIdentity, _ = age.GenerateX25519Identity()
+var otherAgeIdentity, _ = age.GenerateX25519Identity()
+
+var testKey = bytes.Repeat([]byte{0x42}, 32)
+var otherTestKey = bytes.Repeat([]byte{0x24}, 32)
+
 var providers = []ProviderMeta{
 	ProviderMeta{NoopProvider{}, NoopProvider{}, func() bool { return false }, false},
 	ProviderMeta{
@@ -44,6 +56,77 @@ var providers = []ProviderMeta{
 		},
 		true,
 	},
+	ProviderMeta{
+		AWSProvider{
+			Key:      os.Getenv("YAMLCRYPT_TEST_AWS_KEY"),
+			Region:   awsTestRegion(),
+			Endpoint: os.Getenv("YAMLCRYPT_TEST_AWS_ENDPOINT"),
+		},
+		AWSProvider{
+			Key:      "alias/yaml-crypt-nonexistent",
+			Region:   awsTestRegion(),
+			Endpoint: os.Getenv("YAMLCRYPT_TEST_AWS_ENDPOINT"),
+		},
+		func() bool {
+			return os.Getenv("YAMLCRYPT_TEST_AWS_KEY") == ""
+		},
+		true,
+	},
+	ProviderMeta{
+		VaultProvider{
+			Address: os.Getenv("VAULT_ADDR"),
+			Mount:   "transit",
+			Key:     os.Getenv("YAMLCRYPT_TEST_VAULT_KEY"),
+		},
+		VaultProvider{
+			Address: os.Getenv("VAULT_ADDR"),
+			Mount:   "yaml-crypt-nonexistent",
+			Key:     "yaml-crypt",
+		},
+		func() bool {
+			return os.Getenv("VAULT_ADDR") == "" || os.Getenv("YAMLCRYPT_TEST_VAULT_KEY") == ""
+		},
+		true,
+	},
+	ProviderMeta{
+		AgeProvider{
+			Recipients: []age.Recipient{ageIdentity.Recipient()},
+			Identities: []age.Identity{ageIdentity},
+		},
+		AgeProvider{
+			Identities: []age.Identity{otherAgeIdentity},
+		},
+		func() bool { return false },
+		true,
+	},
+	ProviderMeta{
+		KeyfileProvider{Key: testKey},
+		KeyfileProvider{Path: "/nonexistent/yaml-crypt.key"},
+		func() bool { return os.Getenv(KeyfileEnvVar) != "" },
+		true,
+	},
+	ProviderMeta{
+		EnvelopeProvider{Providers: []Provider{
+			KeyfileProvider{Key: testKey},
+			AgeProvider{
+				Recipients: []age.Recipient{ageIdentity.Recipient()},
+				Identities: []age.Identity{ageIdentity},
+			},
+		}},
+		EnvelopeProvider{Providers: []Provider{
+			KeyfileProvider{Path: "/nonexistent/yaml-crypt.key"},
+		}},
+		func() bool { return os.Getenv(KeyfileEnvVar) != "" },
+		true,
+	},
+}
+
+// The AWS tests run against the key in $YAMLCRYPT_TEST_AWS_KEY, optionally via a local KMS stand-in at $YAMLCRYPT_TEST_AWS_ENDPOINT.
+func awsTestRegion() string {
+	if region := os.Getenv("YAMLCRYPT_TEST_AWS_REGION"); region != "" {
+		return region
+	}
+	return "us-east-1"
 }
 
 func TestRoundTrip(t *testing.T) {
@@ -113,3 +196,231 @@ func TestErrorHandling(t *testing.T) {
 		})
 	}
 }
+
+func TestAAD(t *testing.T) {
+	for _, meta := range providers {
+		provider := meta.Provider
+		name := reflect.TypeOf(provider).Name()
+		t.Run(name, func(t *testing.T) {
+			if _, ok := provider.(AADProvider); meta.Skip() || !ok {
+				t.Skip()
+			}
+			aad := []byte("file\n0.\"key\"")
+			ciphertext, err := Encrypt(provider, "test", aad, retries, timeout)
+			if err != nil {
+				t.Fatalf("Provider %s failed to encrypt with AAD: %s", name, err)
+			}
+			plaintext, err := Decrypt(provider, ciphertext, aad, retries, timeout)
+			if err != nil {
+				t.Errorf("Provider %s failed to decrypt with AAD: %s", name, err)
+			} else if plaintext != "test" {
+				t.Errorf("Round-trip with AAD failed for provider %s: got %s", name, strconv.Quote(plaintext))
+			}
+			if _, err = Decrypt(provider, ciphertext, []byte("file\n0.\"other\""), retries, timeout); err == nil {
+				t.Errorf("Provider %s decrypted a ciphertext with the wrong AAD", name)
+			}
+			if _, err = Decrypt(provider, ciphertext, nil, retries, timeout); err == nil {
+				t.Errorf("Provider %s decrypted a ciphertext bound to AAD without any", name)
+			}
+			unbound, err := Encrypt(provider, "test", nil, retries, timeout)
+			if err != nil {
+				t.Fatalf("Provider %s failed to encrypt without AAD: %s", name, err)
+			}
+			if _, err = Decrypt(provider, unbound, aad, retries, timeout); err == nil {
+				t.Errorf("Provider %s decrypted a ciphertext that isn't bound to AAD with some", name)
+			}
+		})
+	}
+	if _, err := Encrypt(NoopProvider{}, "test", []byte("aad"), retries, timeout); err == nil {
+		t.Error("NoopProvider claimed to support AAD")
+	}
+}
+
+func TestAgeIdentityFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	err := ioutil.WriteFile(path, []byte("# test key\n"+ageIdentity.String()+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("YAMLCRYPT_AGE_KEY_FILE", path)
+	provider, err := NewProvider("age", map[string]interface{}{
+		"recipients": []interface{}{ageIdentity.Recipient().String()},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := provider.Encrypt("test", retries, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := provider.Decrypt(ciphertext, retries, timeout)
+	if err != nil {
+		t.Fatalf("Failed to decrypt using identity file: %s", err)
+	}
+	if plaintext != "test" {
+		t.Errorf("Round-trip using identity file gave %s", strconv.Quote(plaintext))
+	}
+	t.Setenv("YAMLCRYPT_AGE_KEY_FILE", filepath.Join(t.TempDir(), "nonexistent.txt"))
+	if _, err = provider.Decrypt(ciphertext, retries, timeout); err == nil {
+		t.Errorf("Decrypting without any identity files did not fail")
+	}
+}
+
+func TestKeyfileCiphertext(t *testing.T) {
+	provider := KeyfileProvider{Key: testKey}
+	ciphertext, err := provider.Encrypt("test", retries, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ciphertext[0] != keyfileVersion {
+		t.Errorf("Ciphertext has version %d, expected %d", ciphertext[0], keyfileVersion)
+	}
+	if id := ciphertext[1 : 1+keyfileKeyIDLength]; !bytes.Equal(id, keyID(testKey)) {
+		t.Errorf("Ciphertext has key id %x, expected %x", id, keyID(testKey))
+	}
+	again, err := provider.Encrypt("test", retries, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(ciphertext, again) {
+		t.Errorf("Encrypting the same plaintext twice gave identical ciphertexts; nonce is not random")
+	}
+	if _, err = (KeyfileProvider{Key: otherTestKey}).Decrypt(ciphertext, retries, timeout); err == nil {
+		t.Errorf("Decrypting with the wrong key did not fail")
+	}
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err = provider.Decrypt(tampered, retries, timeout); err == nil {
+		t.Errorf("Decrypting a tampered ciphertext did not fail")
+	}
+}
+
+func TestKeyfilePath(t *testing.T) {
+	root := t.TempDir()
+	err := GenerateKeyfile(filepath.Join(root, DefaultKeyfileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = GenerateKeyfile(filepath.Join(root, DefaultKeyfileName)); err == nil {
+		t.Errorf("GenerateKeyfile overwrote an existing key file")
+	}
+	t.Setenv(KeyfileEnvVar, "")
+	provider, err := NewProvider("keyfile", map[string]interface{}{"path": DefaultKeyfileName}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := provider.Encrypt("test", retries, timeout)
+	if err != nil {
+		t.Fatalf("Failed to encrypt using key file relative to repo root: %s", err)
+	}
+	plaintext, err := provider.Decrypt(ciphertext, retries, timeout)
+	if err != nil || plaintext != "test" {
+		t.Errorf("Round-trip using key file relative to repo root failed: %v", err)
+	}
+}
+
+func TestEnvelopeFallback(t *testing.T) {
+	recipients := []age.Recipient{ageIdentity.Recipient()}
+	provider := EnvelopeProvider{Providers: []Provider{
+		KeyfileProvider{Key: testKey},
+		AgeProvider{Recipients: recipients},
+	}}
+	ciphertext, err := provider.Encrypt("test", retries, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the second provider is able to unwrap the data key
+	fallback := EnvelopeProvider{Providers: []Provider{
+		KeyfileProvider{Key: otherTestKey},
+		AgeProvider{Recipients: recipients, Identities: []age.Identity{ageIdentity}},
+	}}
+	plaintext, err := fallback.Decrypt(ciphertext, retries, timeout)
+	if err != nil {
+		t.Fatalf("Failed to decrypt using fallback provider: %s", err)
+	}
+	if plaintext != "test" {
+		t.Errorf("Round-trip using fallback provider gave %s", strconv.Quote(plaintext))
+	}
+	// neither provider is able to unwrap the data key
+	none := EnvelopeProvider{Providers: []Provider{
+		KeyfileProvider{Key: otherTestKey},
+		AgeProvider{Recipients: recipients, Identities: []age.Identity{otherAgeIdentity}},
+	}}
+	if _, err = none.Decrypt(ciphertext, retries, timeout); err == nil {
+		t.Errorf("Decrypting without any working provider did not fail")
+	}
+}
+
+func TestEnvelopeHeader(t *testing.T) {
+	provider := EnvelopeProvider{Providers: []Provider{
+		KeyfileProvider{Key: testKey},
+		AgeProvider{
+			Recipients: []age.Recipient{ageIdentity.Recipient()},
+			Identities: []age.Identity{ageIdentity},
+		},
+	}}
+	ciphertext, err := provider.Encrypt("test", retries, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := provider.Encrypt("other", retries, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, _, sealed, err := parseEnvelope(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherWrapped, _, _, err := parseEnvelope(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope := func(keys ...[]byte) []byte {
+		out := []byte{envelopeVersion, byte(len(keys))}
+		for _, key := range keys {
+			length := make([]byte, 4)
+			binary.BigEndian.PutUint32(length, uint32(len(key)))
+			out = append(append(out, length...), key...)
+		}
+		return append(out, sealed...)
+	}
+	if plaintext, err := provider.Decrypt(envelope(wrapped...), retries, timeout); err != nil || plaintext != "test" {
+		t.Fatalf("Decrypting a reassembled ciphertext failed: %q, %v", plaintext, err)
+	}
+	// the first wrapped key still unwraps the data key, but the second one has been swapped for another ciphertext's
+	if _, err := provider.Decrypt(envelope(wrapped[0], otherWrapped[1]), retries, timeout); err == nil {
+		t.Error("Decrypting a ciphertext with a swapped wrapped key did not fail")
+	}
+	if _, err := provider.Decrypt(envelope(wrapped[0]), retries, timeout); err == nil {
+		t.Error("Decrypting a ciphertext with a dropped wrapped key did not fail")
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	notRetryable := func(error) bool { return false }
+	// the first attempt runs out of time, and the second succeeds
+	calls := 0
+	err := retry(func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}, notRetryable, 3, 10*time.Millisecond)
+	if err != nil || calls != 2 {
+		t.Errorf("An attempt that timed out should be retried, got %v after %d calls", err, calls)
+	}
+	// attempts aren't retried once the parent context is done
+	parent, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	calls = 0
+	err = retryContext(parent, func(ctx context.Context) error {
+		calls++
+		<-ctx.Done()
+		return ctx.Err()
+	}, notRetryable, 3, time.Second)
+	if err == nil || calls != 1 {
+		t.Errorf("An attempt shouldn't be retried once the parent context is done, got %v after %d calls", err, calls)
+	}
+}
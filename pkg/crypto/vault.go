@@ -0,0 +1,298 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var vaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultProvider encrypts and decrypts using the Transit secrets engine of a HashiCorp Vault server.
+// Credentials come from the environment, depending on Auth:
+//   - "token": $VAULT_TOKEN, or the token saved in ~/.vault-token by `vault login`
+//   - "approle": $VAULT_ROLE_ID and $VAULT_SECRET_ID
+//   - "kubernetes": the pod's service account token, logging in as Role
+type VaultProvider struct {
+	Address   string
+	Mount     string
+	Key       string
+	Namespace string
+	Auth      string
+	AuthMount string
+	Role      string
+	token     *vaultToken
+}
+
+// A token obtained by logging in, shared between copies of a VaultProvider so that parallel operations only log in once.
+type vaultToken struct {
+	mutex sync.Mutex
+	value string
+	// When the token's lease runs out, or the zero time if it never does.
+	expires time.Time
+}
+
+type vaultError struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e vaultError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("Vault returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("Vault returned status %d: %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+func vaultErrorRetryable(err error) bool {
+	var ve vaultError
+	if _, ok := err.(net.Error); ok {
+		return true
+	} else if errors.As(err, &ve) {
+		// 412 is returned by performance standbys that haven't caught up yet
+		return ve.StatusCode >= 500 || ve.StatusCode == 429 || ve.StatusCode == 412
+	}
+	return false
+}
+
+func (p VaultProvider) client() (*http.Client, error) {
+	caCert := os.Getenv("VAULT_CACERT")
+	if caCert == "" {
+		return http.DefaultClient, nil
+	}
+	pem, err := ioutil.ReadFile(caCert)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading $VAULT_CACERT: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in $VAULT_CACERT file %s", caCert)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}, nil
+}
+
+// Make a request to the Vault API, decoding the JSON response into out.
+func (p VaultProvider) request(ctx context.Context, client *http.Client, token string, path string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(p.Address, "/") + "/v1/" + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errorResponse struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errorResponse)
+		return vaultError{StatusCode: resp.StatusCode, Errors: errorResponse.Errors}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Get a token to authenticate transit requests with, logging in if needed.
+func (p VaultProvider) getToken(ctx context.Context, client *http.Client) (string, error) {
+	if p.token != nil {
+		p.token.mutex.Lock()
+		defer p.token.mutex.Unlock()
+		if p.token.value != "" && (p.token.expires.IsZero() || time.Now().Before(p.token.expires)) {
+			return p.token.value, nil
+		}
+	}
+	var token string
+	var lease time.Duration
+	var err error
+	switch p.Auth {
+	case "", "token":
+		token, err = vaultEnvToken()
+	case "approle", "kubernetes":
+		token, lease, err = p.login(ctx, client)
+	default:
+		err = fmt.Errorf("Unknown Vault auth method %s", p.Auth)
+	}
+	if err != nil {
+		return "", err
+	}
+	if p.token != nil {
+		p.token.value = token
+		p.token.expires = time.Time{}
+		if lease > 0 {
+			// log in again a little early, so the token doesn't expire in the middle of a request
+			p.token.expires = time.Now().Add(lease * 9 / 10)
+		}
+	}
+	return token, nil
+}
+
+// Forget a token that Vault has rejected, unless it's already been replaced.
+func (p VaultProvider) forgetToken(token string) {
+	if p.token == nil {
+		return
+	}
+	p.token.mutex.Lock()
+	defer p.token.mutex.Unlock()
+	if p.token.value == token {
+		p.token.value = ""
+	}
+}
+
+// Make a request to the Transit engine. If Vault rejects the token, it may have expired or been revoked, so it's replaced and the request is tried once more.
+func (p VaultProvider) transit(ctx context.Context, client *http.Client, path string, in interface{}, out interface{}) error {
+	token, err := p.getToken(ctx, client)
+	if err != nil {
+		return err
+	}
+	err = p.request(ctx, client, token, path, in, out)
+	var ve vaultError
+	if !errors.As(err, &ve) || ve.StatusCode != http.StatusForbidden {
+		return err
+	}
+	p.forgetToken(token)
+	if token, err = p.getToken(ctx, client); err != nil {
+		return err
+	}
+	return p.request(ctx, client, token, path, in, out)
+}
+
+func vaultEnvToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	token, err := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+	if os.IsNotExist(err) {
+		return "", errors.New("No Vault token found: set $VAULT_TOKEN or run `vault login`")
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// Log in with the provider's auth method, returning the token and how long it lasts, or 0 if it doesn't expire.
+func (p VaultProvider) login(ctx context.Context, client *http.Client) (string, time.Duration, error) {
+	mount := p.AuthMount
+	if mount == "" {
+		mount = p.Auth
+	}
+	var body map[string]string
+	if p.Auth == "approle" {
+		roleID := os.Getenv("VAULT_ROLE_ID")
+		secretID := os.Getenv("VAULT_SECRET_ID")
+		if roleID == "" || secretID == "" {
+			return "", 0, errors.New("AppRole auth requires $VAULT_ROLE_ID and $VAULT_SECRET_ID")
+		}
+		body = map[string]string{"role_id": roleID, "secret_id": secretID}
+	} else {
+		jwt, err := ioutil.ReadFile(vaultKubernetesTokenPath)
+		if err != nil {
+			return "", 0, fmt.Errorf("Error reading Kubernetes service account token: %w", err)
+		}
+		body = map[string]string{"role": p.Role, "jwt": strings.TrimSpace(string(jwt))}
+	}
+	var result struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := p.request(ctx, client, "", "auth/"+mount+"/login", body, &result); err != nil {
+		return "", 0, fmt.Errorf("Error logging in to Vault: %w", err)
+	}
+	return result.Auth.ClientToken, time.Duration(result.Auth.LeaseDuration) * time.Second, nil
+}
+
+// AAD is passed to the Transit engine as associated data, which requires an AEAD key type.
+func vaultRequestBody(field string, value string, aad []byte) map[string]string {
+	body := map[string]string{field: value}
+	if len(aad) > 0 {
+		body["associated_data"] = base64.StdEncoding.EncodeToString(aad)
+	}
+	return body
+}
+
+func (p VaultProvider) Encrypt(plaintext string, retries uint, timeout time.Duration) ([]byte, error) {
+	return p.EncryptWithAAD(plaintext, nil, retries, timeout)
+}
+
+func (p VaultProvider) EncryptWithAAD(plaintext string, aad []byte, retries uint, timeout time.Duration) ([]byte, error) {
+	var result struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	f := func(ctx context.Context) error {
+		client, err := p.client()
+		if err != nil {
+			return err
+		}
+		body := vaultRequestBody("plaintext", base64.StdEncoding.EncodeToString([]byte(plaintext)), aad)
+		return p.transit(ctx, client, p.Mount+"/encrypt/"+p.Key, body, &result)
+	}
+	err := retry(f, vaultErrorRetryable, retries, timeout)
+	if err != nil {
+		return []byte{}, err
+	} else {
+		return []byte(result.Data.Ciphertext), err
+	}
+}
+
+func (p VaultProvider) Decrypt(ciphertext []byte, retries uint, timeout time.Duration) (string, error) {
+	return p.DecryptWithAAD(ciphertext, nil, retries, timeout)
+}
+
+func (p VaultProvider) DecryptWithAAD(ciphertext []byte, aad []byte, retries uint, timeout time.Duration) (string, error) {
+	var result struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	f := func(ctx context.Context) error {
+		client, err := p.client()
+		if err != nil {
+			return err
+		}
+		body := vaultRequestBody("ciphertext", string(ciphertext), aad)
+		return p.transit(ctx, client, p.Mount+"/decrypt/"+p.Key, body, &result)
+	}
+	err := retry(f, vaultErrorRetryable, retries, timeout)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(result.Data.Plaintext)
+	if err != nil {
+		return "", fmt.Errorf("Error decoding plaintext returned by Vault: %w", err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,246 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/farmersedgeinc/yaml-crypt/pkg/fixtures"
+)
+
+// A stand-in for the Transit secrets engine and the approle and kubernetes auth methods of a Vault server, which "encrypts" by encoding the plaintext and associated data together.
+type vaultStub struct {
+	mutex sync.Mutex
+	// Tokens that are accepted for transit requests.
+	tokens map[string]bool
+	logins int
+	// How long the tokens from logins last, in seconds.
+	lease int
+	// Status codes to fail the next transit requests with, in order.
+	failures []int
+}
+
+type vaultStubCiphertext struct {
+	Plaintext string
+	AAD       string
+}
+
+func newVaultStub(t *testing.T) (*vaultStub, *httptest.Server) {
+	stub := &vaultStub{tokens: map[string]bool{"static-token": true}}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, server
+}
+
+func (s *vaultStub) fail(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": {message}})
+}
+
+func (s *vaultStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var body map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.fail(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	switch {
+	case r.URL.Path == "/v1/auth/approle/login" && body["role_id"] == "role" && body["secret_id"] == "secret",
+		r.URL.Path == "/v1/auth/kubernetes/login" && body["role"] == "yaml-crypt" && body["jwt"] == "service-account-jwt":
+		s.logins++
+		token := fmt.Sprintf("login-token-%d", s.logins)
+		s.tokens[token] = true
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": token, "lease_duration": s.lease}})
+		return
+	case strings.HasPrefix(r.URL.Path, "/v1/auth/"):
+		s.fail(w, http.StatusBadRequest, "invalid credentials")
+		return
+	}
+	if !s.tokens[r.Header.Get("X-Vault-Token")] {
+		s.fail(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		s.fail(w, status, "stub failure")
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/transit/encrypt/yaml-crypt":
+		encoded, _ := json.Marshal(vaultStubCiphertext{Plaintext: body["plaintext"], AAD: body["associated_data"]})
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"ciphertext": "vault:v1:" + base64.StdEncoding.EncodeToString(encoded)}})
+	case "/v1/transit/decrypt/yaml-crypt":
+		var ciphertext vaultStubCiphertext
+		encoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(body["ciphertext"], "vault:v1:"))
+		if err != nil || !strings.HasPrefix(body["ciphertext"], "vault:v1:") || json.Unmarshal(encoded, &ciphertext) != nil {
+			s.fail(w, http.StatusBadRequest, "invalid ciphertext")
+			return
+		}
+		if ciphertext.AAD != body["associated_data"] {
+			s.fail(w, http.StatusBadRequest, "cipher: message authentication failed")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"plaintext": ciphertext.Plaintext}})
+	default:
+		s.fail(w, http.StatusBadRequest, "encryption key not found")
+	}
+}
+
+func newVaultStubProvider(t *testing.T, server *httptest.Server, config map[string]interface{}) Provider {
+	config["address"] = server.URL
+	if _, ok := config["key"]; !ok {
+		config["key"] = "yaml-crypt"
+	}
+	provider, err := NewProvider("vault", config, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestVaultStubRoundTrip(t *testing.T) {
+	_, server := newVaultStub(t)
+	t.Setenv("VAULT_TOKEN", "static-token")
+	provider := newVaultStubProvider(t, server, map[string]interface{}{})
+	for _, original := range fixtures.Strings {
+		ciphertext, err := provider.Encrypt(original, retries, timeout)
+		if err != nil {
+			t.Fatalf("Failed to encrypt with Vault: %s", err)
+		}
+		if !strings.HasPrefix(string(ciphertext), "vault:v1:") {
+			t.Errorf("Ciphertext from Vault should be kept as is, got %s", ciphertext)
+		}
+		plaintext, err := provider.Decrypt(ciphertext, retries, timeout)
+		if err != nil {
+			t.Fatalf("Failed to decrypt with Vault: %s", err)
+		}
+		if plaintext != original {
+			t.Errorf("Round-trip with Vault failed: expected %q, got %q", original, plaintext)
+		}
+	}
+	aad := []byte("file\n0.\"key\"")
+	ciphertext, err := Encrypt(provider, "test", aad, retries, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := Decrypt(provider, ciphertext, aad, retries, timeout); err != nil || plaintext != "test" {
+		t.Errorf("Round-trip with AAD with Vault failed: got %q, %v", plaintext, err)
+	}
+	if _, err := Decrypt(provider, ciphertext, []byte("other"), retries, timeout); err == nil || !strings.Contains(err.Error(), "message authentication failed") {
+		t.Errorf("Decrypting with the wrong AAD should fail with Vault's error, got %v", err)
+	}
+}
+
+func TestVaultStubErrors(t *testing.T) {
+	stub, server := newVaultStub(t)
+	t.Setenv("VAULT_TOKEN", "static-token")
+	missing := newVaultStubProvider(t, server, map[string]interface{}{"key": "missing"})
+	_, err := missing.Encrypt("test", retries, timeout)
+	var ve vaultError
+	if !errors.As(err, &ve) || ve.StatusCode != http.StatusBadRequest || !strings.Contains(err.Error(), "encryption key not found") {
+		t.Errorf("Encrypting with a missing key should fail with Vault's error, got %v", err)
+	}
+	provider := newVaultStubProvider(t, server, map[string]interface{}{})
+	if _, err := provider.Decrypt([]byte("not a ciphertext"), retries, timeout); err == nil || !strings.Contains(err.Error(), "invalid ciphertext") {
+		t.Errorf("Decrypting an invalid ciphertext should fail with Vault's error, got %v", err)
+	}
+	// server errors are retried, client errors aren't
+	stub.failures = []int{http.StatusServiceUnavailable}
+	if _, err := provider.Encrypt("test", retries, timeout); err != nil {
+		t.Errorf("Encrypting should be retried after a server error, got %v", err)
+	}
+	stub.failures = []int{http.StatusBadRequest}
+	if _, err := provider.Encrypt("test", retries, timeout); err == nil {
+		t.Error("Encrypting should fail after a client error")
+	}
+	// a token that's been rejected is still rejected after reading it again
+	t.Setenv("VAULT_TOKEN", "revoked-token")
+	provider = newVaultStubProvider(t, server, map[string]interface{}{})
+	if _, err := provider.Encrypt("test", retries, timeout); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Encrypting with a rejected token should fail, got %v", err)
+	}
+}
+
+func TestVaultStubLogin(t *testing.T) {
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(jwtPath, []byte("service-account-jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defaultPath := vaultKubernetesTokenPath
+	vaultKubernetesTokenPath = jwtPath
+	t.Cleanup(func() { vaultKubernetesTokenPath = defaultPath })
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+	for _, config := range []map[string]interface{}{
+		{"auth": "approle"},
+		{"auth": "kubernetes", "role": "yaml-crypt"},
+	} {
+		stub, server := newVaultStub(t)
+		provider := newVaultStubProvider(t, server, config)
+		for i := 0; i < 3; i++ {
+			ciphertext, err := provider.Encrypt("test", retries, timeout)
+			if err != nil {
+				t.Fatalf("Failed to encrypt with %s auth: %s", config["auth"], err)
+			}
+			if plaintext, err := provider.Decrypt(ciphertext, retries, timeout); err != nil || plaintext != "test" {
+				t.Errorf("Round-trip with %s auth failed: got %q, %v", config["auth"], plaintext, err)
+			}
+		}
+		if stub.logins != 1 {
+			t.Errorf("Expected 1 login with %s auth, got %d", config["auth"], stub.logins)
+		}
+		// once the token is revoked, the provider logs in again, but only once per request
+		stub.tokens = map[string]bool{}
+		if _, err := provider.Encrypt("test", retries, timeout); err != nil {
+			t.Errorf("Encrypting with %s auth after the token was revoked should log in again, got %v", config["auth"], err)
+		}
+		if stub.logins != 2 {
+			t.Errorf("Expected 2 logins with %s auth, got %d", config["auth"], stub.logins)
+		}
+		stub.failures = []int{http.StatusForbidden, http.StatusForbidden}
+		if _, err := provider.Encrypt("test", retries, timeout); err == nil {
+			t.Errorf("Encrypting with %s auth should fail when the new token is rejected too", config["auth"])
+		}
+		if stub.logins != 3 {
+			t.Errorf("Expected 3 logins with %s auth, got %d", config["auth"], stub.logins)
+		}
+	}
+}
+
+func TestVaultStubLease(t *testing.T) {
+	stub, server := newVaultStub(t)
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+	provider := newVaultStubProvider(t, server, map[string]interface{}{"auth": "approle"})
+	token := provider.(VaultProvider).token
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Encrypt("test", retries, timeout); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stub.logins != 1 {
+		t.Errorf("Tokens without a lease should be reused, got %d logins", stub.logins)
+	}
+	// a token whose lease has run out is replaced before it's used
+	stub.lease = 3600
+	token.expires = time.Now().Add(-time.Second)
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Encrypt("test", retries, timeout); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stub.logins != 2 {
+		t.Errorf("An expired token should be replaced once, got %d logins", stub.logins)
+	}
+}
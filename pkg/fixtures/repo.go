@@ -118,6 +118,14 @@ func (r *Repo) Setup() error {
 	if err != nil {
 		return err
 	}
+	// providers that need a local key get a copy of the test key for that provider
+	keyPath := filepath.Join(testDir, "keys", r.Provider+".key")
+	if _, err := os.Stat(keyPath); err == nil {
+		err = cp(keyPath, filepath.Join(r.TmpDir, ".yamlcrypt.key"))
+		if err != nil {
+			return err
+		}
+	}
 	r.OldCwd, err = os.Getwd()
 	if err != nil {
 		return err
@@ -0,0 +1,186 @@
+package yaml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dotenv files have no tags either, so a secret is marked by a comment on the line before it, like "# !secret" or "# !generate cloud-sql", and a ciphertext is stored as the value itself, like KEY=!encrypted:... or KEY=!encrypted:int:...
+const dotenvMarkerPrefix = "# "
+
+// Whether a file is a dotenv file, going by its extension.
+func IsDotenv(path string) bool {
+	return strings.HasSuffix(path, ".env")
+}
+
+// Read a dotenv file into a document with a single mapping of its variables. Comments and blank lines are kept, each followed by a newline, in the HeadComments of the keys they come before, or the FootComment of the mapping.
+func readDotenv(r io.Reader) (yaml.Node, error) {
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	var comments []string
+	var tag string
+	keys := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(text)
+		if marker := strings.Fields(strings.TrimPrefix(trimmed, dotenvMarkerPrefix)); strings.HasPrefix(trimmed, dotenvMarkerPrefix) && len(marker) > 0 {
+			if HasTag(&yaml.Node{Tag: marker[0]}, DecryptedTag) || marker[0] == GenerateTag {
+				tag = strings.Join(marker, " ")
+				continue
+			}
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			comments = append(comments, text+"\n")
+			continue
+		}
+		i := strings.Index(trimmed, "=")
+		if i < 1 {
+			return yaml.Node{}, fmt.Errorf("Invalid dotenv line %d: expected KEY=value", line)
+		}
+		key := strings.TrimSpace(trimmed[:i])
+		if keys[key] {
+			return yaml.Node{}, fmt.Errorf("Invalid dotenv line %d: %s is set more than once", line, key)
+		}
+		keys[key] = true
+		value, err := parseDotenvValue(strings.TrimSpace(trimmed[i+1:]))
+		if err != nil {
+			return yaml.Node{}, fmt.Errorf("Invalid dotenv line %d: %w", line, err)
+		}
+		if tag != "" {
+			fields := strings.Fields(tag)
+			value.Tag = fields[0]
+			value.Style |= yaml.TaggedStyle
+			if value.Tag == GenerateTag {
+				// the profile goes in the value, like it would for a yaml !generate tag
+				value.Value = strings.Join(fields[1:], " ")
+			}
+			tag = ""
+		}
+		mapping.Content = append(mapping.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key, HeadComment: strings.Join(comments, "")},
+			value,
+		)
+		comments = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return yaml.Node{}, err
+	}
+	if tag != "" {
+		return yaml.Node{}, fmt.Errorf("Invalid dotenv file: %s marker isn't followed by a variable", tag)
+	}
+	mapping.FootComment = strings.Join(comments, "")
+	document := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{mapping}}
+	return yaml.Node{Kind: StreamNode, Content: []*yaml.Node{document}}, nil
+}
+
+// Parse the value of a dotenv variable, which may be quoted, an !encrypted ciphertext, or followed by a comment.
+func parseDotenvValue(s string) (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.ScalarNode}
+	switch {
+	case strings.HasPrefix(s, EncryptedTag+":"):
+		// !encrypted:<ciphertext>, or !encrypted:<variant>:<ciphertext>. base64 never contains a colon.
+		rest := strings.TrimPrefix(s, EncryptedTag+":")
+		node.Tag = EncryptedTag
+		if i := strings.Index(rest, ":"); i != -1 {
+			node.Tag += ":" + rest[:i]
+			rest = rest[i+1:]
+		}
+		node.Value = rest
+		node.Style = yaml.TaggedStyle
+	case strings.HasPrefix(s, `"`):
+		end := closingQuote(s)
+		if end == -1 {
+			return nil, fmt.Errorf("Unterminated quoted value %s", s)
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid quoted value %s: %w", s, err)
+		}
+		node.Value = value
+		node.Style = yaml.DoubleQuotedStyle
+		node.LineComment = strings.TrimSpace(s[end+1:])
+	case strings.HasPrefix(s, "'"):
+		end := strings.Index(s[1:], "'")
+		if end == -1 {
+			return nil, fmt.Errorf("Unterminated quoted value %s", s)
+		}
+		node.Value = s[1 : end+1]
+		node.Style = yaml.SingleQuotedStyle
+		node.LineComment = strings.TrimSpace(s[end+2:])
+	default:
+		if i := strings.Index(s, " #"); i != -1 {
+			node.LineComment = strings.TrimSpace(s[i:])
+			s = strings.TrimSpace(s[:i])
+		}
+		node.Value = s
+	}
+	if node.Tag == "" {
+		node.Tag = "!!str"
+	}
+	return node, nil
+}
+
+// Find the index of the quote closing a double-quoted string, skipping escaped quotes.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// Write the mapping in a document read from a dotenv file back out in the same format.
+func writeDotenv(w io.Writer, node yaml.Node) error {
+	docs := documents(&node)
+	if len(docs) != 1 || docs[0].Kind != yaml.DocumentNode || len(docs[0].Content) != 1 || docs[0].Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("A dotenv file must contain a single mapping")
+	}
+	mapping := docs[0].Content[0]
+	var b bytes.Buffer
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		b.WriteString(key.HeadComment)
+		if value.Kind != yaml.ScalarNode {
+			return fmt.Errorf("The value of dotenv variable %s must be a string", key.Value)
+		}
+		if HasTag(value, DecryptedTag) {
+			b.WriteString(dotenvMarkerPrefix + value.Tag + "\n")
+		}
+		b.WriteString(key.Value + "=")
+		if HasTag(value, EncryptedTag) {
+			b.WriteString(value.Tag + ":" + value.Value)
+		} else {
+			b.WriteString(formatDotenvValue(value))
+		}
+		if value.LineComment != "" {
+			b.WriteString(" " + value.LineComment)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(mapping.FootComment)
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// Format the value of a dotenv variable, quoting it if it was quoted, or if it needs to be.
+func formatDotenvValue(node *yaml.Node) string {
+	value := node.Value
+	needsQuotes := value != strings.TrimSpace(value) || strings.ContainsAny(value, "\n\r\"'#\\") || strings.HasPrefix(value, EncryptedTag+":")
+	if node.Style&yaml.SingleQuotedStyle != 0 && !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'"
+	}
+	if node.Style&yaml.DoubleQuotedStyle != 0 || needsQuotes {
+		return strconv.Quote(value)
+	}
+	return value
+}
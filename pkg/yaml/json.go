@@ -0,0 +1,161 @@
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JSON has no tags, so tagged values in JSON files are wrapped in an object with a single key named after the tag, like {"$secret": "hunter2"} or {"$encrypted:int": "..."}.
+const jsonTagPrefix = "$"
+
+// Whether a file is stored as JSON rather than yaml, going by its extension.
+func IsJSON(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// Whether values with a tag are wrapped when they're stored as JSON.
+func isJSONWrappedTag(tag string) bool {
+	node := &yaml.Node{Tag: tag}
+	return tag == GenerateTag || HasTag(node, DecryptedTag) || HasTag(node, EncryptedTag)
+}
+
+// Turn any wrapped values read from a JSON file into tagged Nodes.
+func unwrapJSON(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode && len(node.Content) == 2 && strings.HasPrefix(node.Content[0].Value, jsonTagPrefix) {
+		tag := "!" + strings.TrimPrefix(node.Content[0].Value, jsonTagPrefix)
+		if isJSONWrappedTag(tag) {
+			*node = *node.Content[1]
+			node.Tag = tag
+			node.Style |= yaml.TaggedStyle
+		}
+	}
+	for _, child := range node.Content {
+		unwrapJSON(child)
+	}
+}
+
+// Write a yaml Node as JSON, with one JSON value per document. Keys are kept in their original order, and tagged values are wrapped.
+func WriteJSON(w io.Writer, node yaml.Node) error {
+	var b bytes.Buffer
+	for _, document := range documents(&node) {
+		if err := writeJSONValue(&b, document, ""); err != nil {
+			return err
+		}
+		b.WriteString("\n")
+	}
+	_, err := b.WriteTo(w)
+	return err
+}
+
+func writeJSONValue(b *bytes.Buffer, node *yaml.Node, indent string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			b.WriteString("null")
+			return nil
+		}
+		return writeJSONValue(b, node.Content[0], indent)
+	case yaml.AliasNode:
+		return writeJSONValue(b, node.Alias, indent)
+	}
+	inner := indent + "  "
+	if isJSONWrappedTag(node.Tag) {
+		value := *node
+		value.Tag = ""
+		value.Style &^= yaml.TaggedStyle
+		// ciphertexts are always strings, even if they happen to look like something else
+		if HasTag(node, EncryptedTag) {
+			value.Style |= yaml.DoubleQuotedStyle
+		}
+		b.WriteString("{\n" + inner)
+		writeJSONString(b, jsonTagPrefix+strings.TrimPrefix(node.Tag, "!"))
+		b.WriteString(": ")
+		if err := writeJSONValue(b, &value, inner); err != nil {
+			return err
+		}
+		b.WriteString("\n" + indent + "}")
+		return nil
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+		b.WriteString("{")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n" + inner)
+			writeJSONString(b, node.Content[i].Value)
+			b.WriteString(": ")
+			if err := writeJSONValue(b, node.Content[i+1], inner); err != nil {
+				return err
+			}
+		}
+		b.WriteString("\n" + indent + "}")
+	case yaml.SequenceNode:
+		if len(node.Content) == 0 {
+			b.WriteString("[]")
+			return nil
+		}
+		b.WriteString("[")
+		for i, child := range node.Content {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n" + inner)
+			if err := writeJSONValue(b, child, inner); err != nil {
+				return err
+			}
+		}
+		b.WriteString("\n" + indent + "]")
+	case yaml.ScalarNode:
+		return writeJSONScalar(b, node)
+	default:
+		return fmt.Errorf("Can't write yaml node of kind %d as JSON", node.Kind)
+	}
+	return nil
+}
+
+func writeJSONScalar(b *bytes.Buffer, node *yaml.Node) error {
+	switch node.ShortTag() {
+	case "!!null":
+		b.WriteString("null")
+	case "!!int", "!!float":
+		// numbers that are already valid JSON are kept exactly as they were written
+		if json.Valid([]byte(node.Value)) {
+			b.WriteString(node.Value)
+			return nil
+		}
+		fallthrough
+	case "!!bool":
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("Can't write %s as JSON: %w", node.Value, err)
+		}
+		b.Write(encoded)
+	default:
+		writeJSONString(b, node.Value)
+	}
+	return nil
+}
+
+func writeJSONString(b *bytes.Buffer, s string) {
+	e := json.NewEncoder(b)
+	e.SetEscapeHTML(false)
+	e.Encode(s)
+	// Encode always adds a newline
+	b.Truncate(b.Len() - 1)
+}
@@ -0,0 +1,61 @@
+package yaml
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Tag every untagged value in the data and stringData of the Kubernetes Secrets in a yaml Node as a secret. Values in data are already base64, so they're tagged !secret:base64, and encrypted as their decoded bytes.
+func TagKubernetesSecrets(node *yaml.Node) error {
+	for _, document := range documents(node) {
+		if document.Kind != yaml.DocumentNode || len(document.Content) != 1 || !isKubernetesSecret(document.Content[0]) {
+			continue
+		}
+		if data := mappingValue(document.Content[0], "data"); data != nil && data.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(data.Content); i += 2 {
+				value := data.Content[i+1]
+				if value.Kind != yaml.ScalarNode || (value.Style&yaml.TaggedStyle != 0 && value.Tag != DecryptedTag) {
+					continue
+				}
+				if _, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value.Value)); err != nil {
+					return fmt.Errorf("Invalid base64 in Secret data.%s: %w", data.Content[i].Value, err)
+				}
+				value.Tag = DecryptedTag + ":" + Base64Variant
+				value.Style |= yaml.TaggedStyle
+			}
+		}
+		if stringData := mappingValue(document.Content[0], "stringData"); stringData != nil && stringData.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(stringData.Content); i += 2 {
+				value := stringData.Content[i+1]
+				if value.Kind != yaml.ScalarNode || value.Style&yaml.TaggedStyle != 0 {
+					continue
+				}
+				value.Tag = DecryptedTag
+				value.Style |= yaml.TaggedStyle
+			}
+		}
+	}
+	return nil
+}
+
+// Whether a yaml Node is a Kubernetes Secret manifest.
+func isKubernetesSecret(node *yaml.Node) bool {
+	kind, apiVersion := mappingValue(node, "kind"), mappingValue(node, "apiVersion")
+	return kind != nil && kind.Value == "Secret" && apiVersion != nil && apiVersion.Value == "v1"
+}
+
+// Get the value of a key in a mapping Node, or nil if it isn't a mapping or doesn't have the key.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package yaml
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// Merge the changes made to base in ours and theirs, which are usually StreamNodes. Any of them may be nil, if the file didn't exist. Values changed on only one side take that side's change, and mappings changed on both sides are merged key by key, but !secret mappings and sequences are only ever taken whole, since they're encrypted as a single value.
+// The paths of values changed in different ways on each side are returned as conflicts, and given ours' value, or theirs' value if preferTheirs is set. Nodes are shared with the inputs, not copied.
+func Merge(base *yaml.Node, ours *yaml.Node, theirs *yaml.Node, preferTheirs bool) (*yaml.Node, []*Path) {
+	return merge(base, ours, theirs, &Path{isInt: true}, preferTheirs)
+}
+
+func merge(base *yaml.Node, ours *yaml.Node, theirs *yaml.Node, path *Path, preferTheirs bool) (*yaml.Node, []*Path) {
+	switch {
+	case nodesEqual(ours, theirs), nodesEqual(base, theirs):
+		return ours, nil
+	case nodesEqual(base, ours):
+		return theirs, nil
+	case ours == nil || theirs == nil || ours.Kind != theirs.Kind || (base != nil && base.Kind != ours.Kind) || HasTag(ours, DecryptedTag) || HasTag(theirs, DecryptedTag):
+		// nothing to merge inside of
+	case ours.Kind == yaml.MappingNode:
+		return mergeMappings(base, ours, theirs, path, preferTheirs)
+	case ours.Kind == StreamNode, ours.Kind == yaml.DocumentNode, ours.Kind == yaml.SequenceNode:
+		// documents and sequence items are merged by index, as long as none were added or removed
+		if len(ours.Content) != len(theirs.Content) || (base != nil && len(base.Content) != len(ours.Content)) {
+			break
+		}
+		merged := *ours
+		merged.Content = make([]*yaml.Node, len(ours.Content))
+		var conflicts []*Path
+		for i := range ours.Content {
+			var baseChild *yaml.Node
+			if base != nil {
+				baseChild = base.Content[i]
+			}
+			childPath := path
+			// a document shares its path with its content
+			if ours.Kind != yaml.DocumentNode {
+				childPath = path.AddInt(i)
+			}
+			var childConflicts []*Path
+			merged.Content[i], childConflicts = merge(baseChild, ours.Content[i], theirs.Content[i], childPath, preferTheirs)
+			conflicts = append(conflicts, childConflicts...)
+		}
+		return &merged, conflicts
+	}
+	if preferTheirs {
+		return theirs, []*Path{path}
+	}
+	return ours, []*Path{path}
+}
+
+// Merge mappings key by key, keeping the order of the keys in ours, followed by any only added in theirs.
+func mergeMappings(base *yaml.Node, ours *yaml.Node, theirs *yaml.Node, path *Path, preferTheirs bool) (*yaml.Node, []*Path) {
+	merged := *ours
+	merged.Content = nil
+	var conflicts []*Path
+	add := func(key *yaml.Node, ourValue *yaml.Node, theirValue *yaml.Node) {
+		var baseValue *yaml.Node
+		if base != nil {
+			baseValue = mappingValue(base, key.Value)
+		}
+		value, childConflicts := merge(baseValue, ourValue, theirValue, path.AddString(key.Value), preferTheirs)
+		conflicts = append(conflicts, childConflicts...)
+		if value != nil {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	for i := 0; i+1 < len(ours.Content); i += 2 {
+		add(ours.Content[i], ours.Content[i+1], mappingValue(theirs, ours.Content[i].Value))
+	}
+	for i := 0; i+1 < len(theirs.Content); i += 2 {
+		if mappingValue(ours, theirs.Content[i].Value) == nil {
+			add(theirs.Content[i], nil, theirs.Content[i+1])
+		}
+	}
+	return &merged, conflicts
+}
+
+// Whether two yaml Nodes, either of which may be nil, have the same kinds, tags, and values all the way down. Styles and comments don't matter.
+func nodesEqual(a *yaml.Node, b *yaml.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Kind == yaml.AliasNode && b.Kind == yaml.AliasNode {
+		return nodesEqual(a.Alias, b.Alias)
+	}
+	if a.Kind != b.Kind || a.ShortTag() != b.ShortTag() || a.Value != b.Value || len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !nodesEqual(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
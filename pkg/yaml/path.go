@@ -1,6 +1,7 @@
 package yaml
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -46,3 +47,119 @@ func (p *Path) String() string {
 	}
 	return strings.Join(out, ".")
 }
+
+// A segment of a path string, and whether it was quoted.
+type pathSegment struct {
+	value  string
+	quoted bool
+}
+
+// Split a path in the format produced by Path.String() into its segments, unquoting any quoted ones.
+func splitPath(s string) ([]pathSegment, error) {
+	var segments []pathSegment
+	if s == "" {
+		return segments, nil
+	}
+	for rest := s; ; {
+		if strings.HasPrefix(rest, "\"") {
+			// find the closing quote, skipping escaped characters
+			end := 1
+			for ; end < len(rest) && rest[end] != '"'; end++ {
+				if rest[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(rest) {
+				return nil, fmt.Errorf("Unterminated quoted segment in path %s", s)
+			}
+			key, err := strconv.Unquote(rest[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid quoted segment in path %s: %w", s, err)
+			}
+			segments = append(segments, pathSegment{value: key, quoted: true})
+			rest = rest[end+1:]
+			if rest != "" && !strings.HasPrefix(rest, ".") {
+				return nil, fmt.Errorf("Expected . after quoted segment in path %s", s)
+			}
+		} else {
+			end := strings.Index(rest, ".")
+			if end == -1 {
+				end = len(rest)
+			}
+			var segment string
+			segment, rest = rest[:end], rest[end:]
+			if segment == "" {
+				return nil, fmt.Errorf("Empty segment in path %s", s)
+			}
+			segments = append(segments, pathSegment{value: segment})
+		}
+		if rest == "" {
+			return segments, nil
+		}
+		rest = rest[1:]
+		if rest == "" {
+			return nil, fmt.Errorf("Trailing . in path %s", s)
+		}
+	}
+}
+
+// Whether an unquoted path segment is a sequence index.
+func isIndex(segment string) bool {
+	return segment != "" && strings.Trim(segment, "0123456789") == ""
+}
+
+// Parse a path in the format produced by Path.String(). Unquoted segments are also accepted: ones made up of only digits are sequence indexes, anything else is a mapping key.
+func ParsePath(s string) (*Path, error) {
+	segments, err := splitPath(s)
+	if err != nil {
+		return nil, err
+	}
+	path := &Path{isInt: true}
+	for _, segment := range segments {
+		if i, err := strconv.Atoi(segment.value); err == nil && !segment.quoted && isIndex(segment.value) {
+			path = path.AddInt(i)
+		} else {
+			path = path.AddString(segment.value)
+		}
+	}
+	return path, nil
+}
+
+// Get the segments of a path, from the root down: mapping keys, and sequence indexes formatted as decimal numbers.
+func (p *Path) Segments() []string {
+	var out []string
+	for entry := p; entry != nil && entry.parent != nil; entry = entry.parent {
+		if entry.isInt {
+			out = append([]string{strconv.Itoa(entry.i)}, out...)
+		} else {
+			out = append([]string{entry.s}, out...)
+		}
+	}
+	return out
+}
+
+// Get the entries of a path that hold its keys and indexes, from the root down.
+func (p *Path) entries() []*Path {
+	var out []*Path
+	for entry := p; entry != nil && entry.parent != nil; entry = entry.parent {
+		out = append([]*Path{entry}, out...)
+	}
+	return out
+}
+
+// Split a path within a file into the index of its document, and the path within that document.
+func (p *Path) Document() (int, *Path) {
+	entries := p.entries()
+	rest := &Path{isInt: true}
+	if len(entries) == 0 {
+		return 0, rest
+	}
+	for _, entry := range entries[1:] {
+		if entry.isInt {
+			rest = rest.AddInt(entry.i)
+		} else {
+			rest = rest.AddString(entry.s)
+		}
+	}
+	return entries[0].i, rest
+}
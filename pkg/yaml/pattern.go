@@ -0,0 +1,118 @@
+package yaml
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A pattern that matches the paths of values within a yaml document, ignoring the document's index.
+// Patterns are either in the format produced by Path.String(), where unquoted segments can contain glob wildcards, * matches any one key or index, and ** matches any number of them (eg. **.password, data.*);
+// or regular expressions between slashes (eg. /^db\..*_key$/), matched against the path's segments joined by dots.
+type PathPattern struct {
+	segments []pathSegment
+	regex    *regexp.Regexp
+}
+
+func ParsePathPattern(s string) (*PathPattern, error) {
+	if len(s) > 1 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		regex, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regex in path pattern %s: %w", s, err)
+		}
+		return &PathPattern{regex: regex}, nil
+	}
+	segments, err := splitPath(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		if _, err := path.Match(segment.value, ""); !segment.quoted && err != nil {
+			return nil, fmt.Errorf("Invalid segment %s in path pattern %s: %w", segment.value, s, err)
+		}
+	}
+	return &PathPattern{segments: segments}, nil
+}
+
+// Whether the pattern matches a path produced while iterating over a document or stream, whose first segment is the document's index.
+func (p *PathPattern) Match(path *Path) bool {
+	segments := path.Segments()
+	if len(segments) == 0 {
+		return false
+	}
+	segments = segments[1:]
+	if p.regex != nil {
+		return p.regex.MatchString(strings.Join(segments, "."))
+	}
+	return matchSegments(p.segments, segments)
+}
+
+func matchSegments(pattern []pathSegment, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	first := pattern[0]
+	if !first.quoted && first.value == "**" {
+		// try matching the rest of the pattern after skipping any number of segments
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if first.quoted {
+		if first.value != segments[0] {
+			return false
+		}
+	} else if ok, _ := path.Match(first.value, segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+func matchesAny(patterns []*PathPattern, path *Path) bool {
+	for _, pattern := range patterns {
+		if pattern.Match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tag any untagged values in a yaml Node whose paths match any of the patterns. Values inside ones that were already tagged, or have just been tagged, are left alone.
+func TagMatching(node *yaml.Node, patterns []*PathPattern, tag string) {
+	if len(patterns) == 0 {
+		return
+	}
+	tagged := map[*Path]bool{}
+	isTagged := func(n *yaml.Node) bool { return n.Style&yaml.TaggedStyle != 0 }
+	for n := range recursiveNodeIter(node, isTagged) {
+		if n.Path == nil || isTagged(n.YamlNode) {
+			continue
+		}
+		switch n.YamlNode.Kind {
+		case yaml.ScalarNode, yaml.MappingNode, yaml.SequenceNode:
+		default:
+			continue
+		}
+		inside := false
+		for p := n.Path.parent; p != nil && !inside; p = p.parent {
+			inside = tagged[p]
+		}
+		if inside {
+			continue
+		}
+		if matchesAny(patterns, n.Path) {
+			n.YamlNode.Tag = tag
+			n.YamlNode.Style |= yaml.TaggedStyle
+			tagged[n.Path] = true
+		}
+	}
+}
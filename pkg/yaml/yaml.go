@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/farmersedgeinc/yaml-crypt/pkg/cache"
 	"gopkg.in/yaml.v3"
@@ -21,13 +23,17 @@ const (
 	GenerateTag = "!generate"
 )
 
+// yaml.v3 has no Kind for a stream of documents, so ReadFile returns a Node of this Kind, with each DocumentNode in its Content.
+const StreamNode yaml.Kind = 0
+
 // these relations need to be stored to produce "paths" for encrypted values, which is needed for encrypted item reuse
 type nodeNode struct {
 	YamlNode *yaml.Node
 	Path     *Path
 }
 
-func recursiveNodeIter(node *yaml.Node) <-chan *nodeNode {
+// Iterate over a yaml Node and all of its descendents, except for the descendents of nodes that skipChildren returns true for.
+func recursiveNodeIter(node *yaml.Node, skipChildren func(*yaml.Node) bool) <-chan *nodeNode {
 	out := make(chan *nodeNode)
 	go func() {
 		defer close(out)
@@ -40,6 +46,9 @@ func recursiveNodeIter(node *yaml.Node) <-chan *nodeNode {
 					if index > 0 && index%2 == 1 {
 						path = parent.Path.AddString(parent.YamlNode.Content[index-1].Value)
 					}
+				} else if parent.YamlNode.Kind == yaml.DocumentNode && parent.Path.parent != nil {
+					// a document in a stream shares its path with its content, so the first document's paths are the same as for a lone document
+					path = parent.Path
 				} else {
 					path = parent.Path.AddInt(index)
 				}
@@ -48,9 +57,13 @@ func recursiveNodeIter(node *yaml.Node) <-chan *nodeNode {
 			}
 			current := &nodeNode{YamlNode: node, Path: path}
 
+			// the consumer may modify the node once it's been yielded, so decide what to descend into first
+			var children []*yaml.Node
+			if skipChildren == nil || !skipChildren(node) {
+				children = node.Content
+			}
 			out <- current
-			parent = current
-			for index, childNode := range node.Content {
+			for index, childNode := range children {
 				recurse(childNode, current, index)
 			}
 		}
@@ -71,13 +84,19 @@ func DeepCopyNode(node *yaml.Node) *yaml.Node {
 	return &result
 }
 
-// A Channel-based iterator that yields all descendents of a yaml Node that match a given tag.
+// Whether a yaml Node is tagged with the given tag, or a variant of it, like !encrypted:map.
+func HasTag(node *yaml.Node, tag string) bool {
+	return node.Tag == tag || strings.HasPrefix(node.Tag, tag+":")
+}
+
+// A Channel-based iterator that yields all descendents of a yaml Node that match a given tag, or a variant of it. The descendents of matching nodes aren't searched, since they're encrypted along with them.
 func GetTaggedChildren(node *yaml.Node, tag string) <-chan *nodeNode {
 	out := make(chan *nodeNode)
+	matches := func(n *yaml.Node) bool { return HasTag(n, tag) }
 	go func() {
 		defer close(out)
-		for node := range recursiveNodeIter(node) {
-			if node.YamlNode.Tag == tag {
+		for node := range recursiveNodeIter(node, matches) {
+			if matches(node.YamlNode) {
 				out <- node
 			}
 		}
@@ -99,21 +118,72 @@ func GetTaggedChildrenValues(node *yaml.Node, tag string) (out map[string]string
 	return
 }
 
-// Read a yaml file, and return its root yaml Node.
+// A value tagged !secret, decoded like GetValue does, along with its path and the tag it's encrypted with, which records its type.
+type SecretValue struct {
+	Path  *Path
+	Value string
+	Tag   string
+}
+
+// Get the values of all descendents of a yaml Node tagged !secret, in the order they appear, or only those whose paths match any of the given patterns if there are any.
+func GetSecretValues(node *yaml.Node, patterns []*PathPattern) ([]SecretValue, error) {
+	var out []SecretValue
+	for n := range GetTaggedChildren(node, DecryptedTag) {
+		if len(patterns) > 0 && !matchesAny(patterns, n.Path) {
+			continue
+		}
+		value, err := GetValue(n.YamlNode)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting value at %s: %w", n.Path.String(), err)
+		}
+		out = append(out, SecretValue{Path: n.Path, Value: value, Tag: EncryptedTagOf(n.YamlNode)})
+	}
+	return out, nil
+}
+
+// Read a yaml file, and return a StreamNode containing all of its documents. JSON files are read the same way, with their wrapped values turned into tagged Nodes, and dotenv files are read as a single mapping.
 func ReadFile(path string) (node yaml.Node, err error) {
 	f, err := os.Open(path)
 	defer f.Close()
 	if err != nil {
 		return
 	}
-	err = yaml.NewDecoder(f).Decode(&node)
-	return
+	return Read(f, path)
 }
 
-// Save a yaml Node to a file.
+// Read a yaml Node in the format of the file at path, like ReadFile does.
+func Read(r io.Reader, path string) (node yaml.Node, err error) {
+	if IsDotenv(path) {
+		return readDotenv(r)
+	}
+	node.Kind = StreamNode
+	decoder := yaml.NewDecoder(r)
+	for {
+		var document yaml.Node
+		err = decoder.Decode(&document)
+		if err == io.EOF && len(node.Content) > 0 {
+			if IsJSON(path) {
+				unwrapJSON(&node)
+			}
+			return node, nil
+		} else if err != nil {
+			return
+		}
+		node.Content = append(node.Content, &document)
+	}
+}
+
+// Get the documents in a yaml Node: the Content of a StreamNode, or else just the Node itself.
+func documents(node *yaml.Node) []*yaml.Node {
+	if node.Kind == StreamNode {
+		return node.Content
+	}
+	return []*yaml.Node{node}
+}
+
+// Save a yaml Node to a file, in the file's format.
 func SaveFile(path string, node yaml.Node) error {
 	var w io.Writer
-	var err error
 	if path == "" {
 		w = os.Stdout
 	} else {
@@ -125,25 +195,48 @@ func SaveFile(path string, node yaml.Node) error {
 		if err != nil {
 			return err
 		}
+		defer f.Close()
 		w = f
 	}
+	return Write(w, path, node)
+}
+
+// Write a yaml Node in the format of the file at path: JSON, dotenv, or otherwise yaml.
+func Write(w io.Writer, path string, node yaml.Node) error {
+	if IsJSON(path) {
+		return WriteJSON(w, node)
+	} else if IsDotenv(path) {
+		return writeDotenv(w, node)
+	}
+	var err error
 	e := yaml.NewEncoder(w)
 	e.SetIndent(2)
-	err = e.Encode(&node)
+	for _, document := range documents(&node) {
+		if err = e.Encode(document); err != nil {
+			return err
+		}
+	}
 	return err
 }
 
+// Print a yaml Node to stdout as JSON, with one JSON value per document.
 func PrintJSON(node yaml.Node) error {
-	var temp interface{}
-	if err := node.Decode(&temp); err != nil {
-		return err
+	e := json.NewEncoder(os.Stdout)
+	for _, document := range documents(&node) {
+		var temp interface{}
+		if err := document.Decode(&temp); err != nil {
+			return err
+		}
+		if err := e.Encode(temp); err != nil {
+			return err
+		}
 	}
-	return json.NewEncoder(os.Stdout).Encode(temp)
+	return nil
 }
 
-// Get the decoded value of an !encrypted or !secret Node, as a String. !encrypted Nodes are base64-decoded.
+// Get the decoded value of an !encrypted or !secret Node, as a String. !encrypted and !secret:base64 Nodes are base64-decoded, and !secret mappings and sequences are serialized as yaml.
 func GetValue(node *yaml.Node) (value string, err error) {
-	if node.Tag == EncryptedTag {
+	if HasTag(node, EncryptedTag) {
 		var encodedCiphertext string
 		err = node.Decode(&encodedCiphertext)
 		if err != nil {
@@ -152,6 +245,15 @@ func GetValue(node *yaml.Node) (value string, err error) {
 		var bytes []byte
 		bytes, err = base64.StdEncoding.DecodeString(encodedCiphertext)
 		value = string(bytes)
+	} else if node.Tag == DecryptedTag+":"+Base64Variant {
+		var bytes []byte
+		bytes, err = base64.StdEncoding.DecodeString(strings.TrimSpace(node.Value))
+		if err != nil {
+			err = fmt.Errorf("Invalid base64 in %s value: %w", node.Tag, err)
+		}
+		value = string(bytes)
+	} else if node.Tag == DecryptedTag && (node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode) {
+		value, err = marshalCollection(node)
 	} else if node.Tag == DecryptedTag {
 		err = node.Decode(&value)
 	} else {
@@ -160,19 +262,87 @@ func GetValue(node *yaml.Node) (value string, err error) {
 	return
 }
 
-// Strip the tag from any children of a yaml Node that are tagged with the given tag.
+// Strip the tag from any children of a yaml Node that are tagged with the given tag, including those nested inside other tagged nodes.
 func StripTags(node *yaml.Node, tag string) {
-	for child := range GetTaggedChildren(node, tag) {
-		child.YamlNode.Tag = ""
+	for child := range recursiveNodeIter(node, nil) {
+		if HasTag(child.YamlNode, tag) {
+			child.YamlNode.Tag = ""
+		}
+	}
+}
+
+// The variants of the !encrypted tag, for values that aren't strings.
+const (
+	encryptedMapVariant = "map"
+	encryptedSeqVariant = "seq"
+	// A base64 value, like in a Kubernetes Secret's data, which is tagged !secret:base64 and encrypted as its decoded bytes.
+	Base64Variant = "base64"
+)
+
+// The scalar types that are preserved through encryption, by their variant of the !encrypted tag. Any other scalars are treated as strings.
+var encryptedScalarVariants = map[string]string{
+	"!!int":   "int",
+	"!!bool":  "bool",
+	"!!float": "float",
+}
+
+func isScalarVariant(variant string) bool {
+	for _, v := range encryptedScalarVariants {
+		if v == variant {
+			return true
+		}
 	}
+	return false
 }
 
-// Turn a yaml Node tagged !encrypted into a yaml Node tagged !secret, by looking up its values in a give mapping of ciphertexts to plaintexts.
-func DecryptNode(node *yaml.Node, cache cache.Cache) error {
+// Get the variant of the !encrypted tag for a scalar Node tagged !secret, from the type it would have had without the tag.
+func scalarVariant(node *yaml.Node) string {
+	if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		return ""
+	}
+	untagged := yaml.Node{Kind: yaml.ScalarNode, Value: node.Value}
+	return encryptedScalarVariants[untagged.ShortTag()]
+}
+
+// Serialize a mapping or sequence Node tagged !secret, so it can be encrypted as a single value.
+func marshalCollection(node *yaml.Node) (string, error) {
+	collection := *node
+	collection.Tag = ""
+	var b strings.Builder
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(&collection); err != nil {
+		return "", err
+	}
+	if err := e.Close(); err != nil {
+		return "", err
+	}
+	// make sure it can be restored, which isn't the case if it refers to anchors outside of itself
+	if _, err := unmarshalCollection(b.String()); err != nil {
+		return "", fmt.Errorf("Secret collection can't be restored after encryption: %w", err)
+	}
+	return b.String(), nil
+}
+
+// Restore a mapping or sequence Node serialized by marshalCollection.
+func unmarshalCollection(plaintext string) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(plaintext), &document); err != nil {
+		return nil, err
+	}
+	if document.Kind != yaml.DocumentNode || len(document.Content) != 1 {
+		return nil, errors.New("Expected a single yaml document")
+	}
+	return document.Content[0], nil
+}
+
+// Turn a yaml Node tagged !encrypted into a yaml Node tagged !secret, by looking up its values in a give mapping of ciphertexts to plaintexts. aad is the additional authenticated data the ciphertext is bound to, if any.
+func DecryptNode(node *yaml.Node, aad []byte, cache cache.Cache) error {
 	// validate, read in data
-	if node.Tag != EncryptedTag {
+	if !HasTag(node, EncryptedTag) {
 		return fmt.Errorf("Cannot decrypt a node not tagged %s", EncryptedTag)
 	}
+	variant := strings.TrimPrefix(strings.TrimPrefix(node.Tag, EncryptedTag), ":")
 	var encodedCiphertext string
 	err := node.Decode(&encodedCiphertext)
 	if err != nil {
@@ -183,36 +353,190 @@ func DecryptNode(node *yaml.Node, cache cache.Cache) error {
 		return err
 	}
 	// decrypt
-	plaintext, ok, err := cache.Decrypt(ciphertext)
+	plaintext, ok, err := cache.Decrypt(ciphertext, aad)
 	if err != nil {
 		return err
 	} else if !ok {
 		return errors.New("Ciphertext not found in cache. This should never happen.")
 	}
 	// replace the node contents
-	node.Encode(plaintext)
-	node.Tag = DecryptedTag
+	tag := DecryptedTag
+	switch variant {
+	case "":
+		node.Encode(plaintext)
+	case Base64Variant:
+		node.Encode(base64.StdEncoding.EncodeToString([]byte(plaintext)))
+		tag += ":" + Base64Variant
+	case encryptedMapVariant, encryptedSeqVariant:
+		collection, err := unmarshalCollection(plaintext)
+		if err != nil {
+			return fmt.Errorf("Error restoring encrypted %s: %w", variant, err)
+		}
+		*node = *collection
+	default:
+		if !isScalarVariant(variant) {
+			return fmt.Errorf("Unknown encrypted value type %s", node.Tag)
+		}
+		// a plain scalar, so it resolves to its original type once the tag is stripped
+		*node = yaml.Node{Kind: yaml.ScalarNode, Value: plaintext}
+	}
+	node.Tag = tag
 	return nil
 }
 
-// Turn a yaml Node tagged !secret into a yaml Node tagged !encrypted, looking up its values in a given mapping of plaintexts to ciphertexts.
-func EncryptNode(node *yaml.Node, possibleCiphertext []byte, cache cache.Cache) error {
+// Get the tag a secret value is encrypted with, which records the type of its value so it can be restored: the tag of a yaml Node tagged !encrypted, or the one a yaml Node tagged !secret is given when it's encrypted.
+func EncryptedTagOf(node *yaml.Node) string {
+	if HasTag(node, EncryptedTag) {
+		return node.Tag
+	}
+	tag := EncryptedTag
+	switch {
+	case node.Tag != DecryptedTag:
+		tag += ":" + Base64Variant
+	case node.Kind == yaml.MappingNode:
+		tag += ":" + encryptedMapVariant
+	case node.Kind == yaml.SequenceNode:
+		tag += ":" + encryptedSeqVariant
+	case node.Kind == yaml.ScalarNode:
+		if variant := scalarVariant(node); variant != "" {
+			tag += ":" + variant
+		}
+	}
+	return tag
+}
+
+// Turn a yaml Node tagged !secret into a yaml Node tagged !encrypted, looking up its values in a given mapping of plaintexts to ciphertexts. aad is the additional authenticated data to bind the ciphertext to, if any.
+func EncryptNode(node *yaml.Node, aad []byte, possibleCiphertext []byte, cache cache.Cache) error {
 	// validate, read in data
-	if node.Tag != DecryptedTag {
+	if node.Tag != DecryptedTag && node.Tag != DecryptedTag+":"+Base64Variant {
 		return fmt.Errorf("Cannot encrypt a node not tagged %s", DecryptedTag)
 	}
-	var plaintext string
-	err := node.Decode(&plaintext)
+	tag := EncryptedTagOf(node)
+	plaintext, err := GetValue(node)
 	if err != nil {
 		return err
 	}
 	// encrypt
-	ciphertext, ok, err := cache.Encrypt(plaintext, possibleCiphertext)
+	ciphertext, ok, err := cache.Encrypt(plaintext, aad, possibleCiphertext)
 	if !ok {
 		return errors.New("Plaintext not found in cache. This should never happen.")
 	}
 	// replace the node contents
 	node.Encode(base64.StdEncoding.EncodeToString([]byte(ciphertext)))
-	node.Tag = EncryptedTag
+	node.Tag = tag
 	return nil
 }
+
+// Find the descendent of a yaml Node at a path within one of its documents, and return it along with its full path, starting with the index of the document. Nodes tagged !encrypted in the way are passed to decrypt, along with their paths, before they're searched.
+func FindNode(node *yaml.Node, document int, path *Path, decrypt func(*yaml.Node, *Path) error) (*yaml.Node, *Path, error) {
+	docs := documents(node)
+	if document < 0 || document >= len(docs) {
+		return nil, nil, fmt.Errorf("There's no document %d", document)
+	}
+	current := docs[document]
+	found := (&Path{isInt: true}).AddInt(document)
+	if current.Kind == yaml.DocumentNode {
+		if len(current.Content) == 0 {
+			return nil, nil, fmt.Errorf("Document %d is empty", document)
+		}
+		current = current.Content[0]
+	}
+	for _, entry := range path.entries() {
+		if HasTag(current, EncryptedTag) {
+			if err := decrypt(current, found); err != nil {
+				return nil, nil, err
+			}
+		}
+		switch current.Kind {
+		case yaml.MappingNode:
+			key := entry.s
+			if entry.isInt {
+				key = strconv.Itoa(entry.i)
+			}
+			child := mappingValue(current, key)
+			if child == nil {
+				return nil, nil, fmt.Errorf("There's no key %s at %s", strconv.Quote(key), found.String())
+			}
+			current, found = child, found.AddString(key)
+		case yaml.SequenceNode:
+			if !entry.isInt {
+				return nil, nil, fmt.Errorf("The value at %s is a sequence, so it has no key %s", found.String(), strconv.Quote(entry.s))
+			} else if entry.i >= len(current.Content) {
+				return nil, nil, fmt.Errorf("There's no index %d in the sequence at %s", entry.i, found.String())
+			}
+			current, found = current.Content[entry.i], found.AddInt(entry.i)
+		default:
+			return nil, nil, fmt.Errorf("The value at %s isn't a mapping or sequence", found.String())
+		}
+	}
+	return current, found, nil
+}
+
+// Set the value at a path within one of the documents of a yaml Node, creating any mappings in the way that don't exist yet, and return its full path, starting with the index of the document. The new Node is made by passing its full path to value. Comments on a value that's replaced are kept.
+func SetNode(node *yaml.Node, document int, path *Path, value func(*Path) (*yaml.Node, error)) (*Path, error) {
+	docs := documents(node)
+	if document < 0 || document >= len(docs) {
+		return nil, fmt.Errorf("There's no document %d", document)
+	}
+	entries := path.entries()
+	if len(entries) == 0 {
+		return nil, errors.New("Can't replace a whole document")
+	}
+	current := docs[document]
+	if current.Kind == yaml.DocumentNode {
+		if len(current.Content) == 0 {
+			current.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+		}
+		current = current.Content[0]
+	}
+	found := (&Path{isInt: true}).AddInt(document)
+	for i, entry := range entries {
+		if HasTag(current, EncryptedTag) {
+			return nil, fmt.Errorf("The value at %s is encrypted as a whole, so nothing inside it can be set", found.String())
+		}
+		// the index of the child in the Content of current, which is appended if it doesn't exist yet
+		var index int
+		switch current.Kind {
+		case yaml.MappingNode:
+			key := entry.s
+			if entry.isInt {
+				key = strconv.Itoa(entry.i)
+			}
+			index = -1
+			for j := 0; j+1 < len(current.Content) && index == -1; j += 2 {
+				if current.Content[j].Value == key {
+					index = j + 1
+				}
+			}
+			if index == -1 {
+				current.Content = append(current.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+				index = len(current.Content) - 1
+			}
+			found = found.AddString(key)
+		case yaml.SequenceNode:
+			if !entry.isInt {
+				return nil, fmt.Errorf("The value at %s is a sequence, so it has no key %s", found.String(), strconv.Quote(entry.s))
+			} else if entry.i > len(current.Content) {
+				return nil, fmt.Errorf("There's no index %d in the sequence at %s", entry.i, found.String())
+			} else if entry.i == len(current.Content) {
+				current.Content = append(current.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+			}
+			index = entry.i
+			found = found.AddInt(entry.i)
+		default:
+			return nil, fmt.Errorf("The value at %s isn't a mapping or sequence", found.String())
+		}
+		if i < len(entries)-1 {
+			current = current.Content[index]
+			continue
+		}
+		old := current.Content[index]
+		new, err := value(found)
+		if err != nil {
+			return nil, err
+		}
+		new.HeadComment, new.LineComment, new.FootComment = old.HeadComment, old.LineComment, old.FootComment
+		current.Content[index] = new
+	}
+	return found, nil
+}